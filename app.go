@@ -3,13 +3,18 @@ package pericyte
 import (
 	"context"
 	"fmt"
+	"net"
+	"time"
 
 	"code.monax.io/monax/pericyte/config"
 	"code.monax.io/monax/pericyte/data"
+	"code.monax.io/monax/pericyte/emailaddress"
 	"code.monax.io/monax/pericyte/emailing"
 	"code.monax.io/monax/pericyte/identity"
 	"code.monax.io/monax/pericyte/ops"
 	"code.monax.io/monax/pericyte/services"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/redemption"
 	"code.monax.io/monax/pericyte/workers"
 	"github.com/keratin/authn-server/app"
 	"github.com/sirupsen/logrus"
@@ -23,15 +28,31 @@ type App struct {
 	UserStore   data.UserStoreTransactor
 	Identity    *identity.IDProvider
 	Dispatchers *Dispatchers
-	Logger      logrus.FieldLogger
-	queue       taskq.Queue
-	close       func()
+	// Delivery events reported by the email provider
+	EmailEvents emailing.EventStore
+	// Verifies provider event webhook requests, nil when no verification key is configured
+	EmailWebhook *emailing.WebhookVerifier
+	// Checks the quality of addresses given at signup, nil when no checks are configured
+	EmailChecker *emailaddress.Checker
+	// Messages we have sent, nil when archiving is not configured
+	EmailArchive emailing.ArchiveStore
+	// Renders messages the way the configured sender would send them
+	EmailRenderer emailing.Renderer
+	// Single-use tokens that have been used
+	TokenRedemptions redemption.Store
+	// Addresses we will not send to
+	EmailSuppressions emailing.SuppressionStore
+	Logger            logrus.FieldLogger
+	queue             taskq.Queue
+	close             func()
 }
 
 type Dispatchers struct {
-	SignupEmail        func(email string) error
-	PasswordResetEmail func(email string) error
-	VerifyEmail        func(accountID int, email string) error
+	SignupEmail        func(email string, mc services.MailContext) error
+	PasswordResetEmail func(email string, mc services.MailContext) error
+	VerifyEmail        func(accountID int, email string, mc services.MailContext) error
+	EmailChanged       func(accountID int, email string, mc services.MailContext) error
+	LoginEmail         func(email string, mc services.MailContext) error
 }
 
 func NewApp(cfg *config.Config, logger *logrus.Logger) (*App, error) {
@@ -41,12 +62,83 @@ func NewApp(cfg *config.Config, logger *logrus.Logger) (*App, error) {
 	}
 	keratinApp.Logger = logger.WithField("scope", "KeratinApp")
 
-	userStore := data.NewUserStoreTransactor(keratinApp.DB)
-	emailSender := emailing.NewSender(cfg.Email.SenderType, cfg.Email.Credentials, logger)
+	err = tokens.Keyring(cfg).Load(time.Now())
+	if err != nil {
+		return nil, err
+	}
 
-	// This context can be used to abort all taskq message handlers (provided they take context and listen to it)
+	// This context can be used to abort all taskq message handlers (provided they take context and listen to it) and
+	// sends waiting for rate limit capacity
 	ctx, cancel := context.WithCancel(context.Background())
 
+	userStore := data.NewUserStoreTransactor(keratinApp.DB)
+	emailSender, err := emailing.NewSender(cfg.Email.SenderType, cfg.Email.Credentials, cfg.Email.SendGrid,
+		cfg.Email.SMTP, logger)
+	if err != nil {
+		return nil, err
+	}
+	emailRenderer, err := emailing.NewRenderer(cfg.Email.SenderType, cfg.Email.SMTP)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Email.RateLimit != nil {
+		// Shared by all dispatchers and applied last so that only messages actually sent count against the quota
+		emailSender = emailing.NewRateLimitedSender(ctx, emailSender, cfg.Email.RateLimit)
+	}
+	if cfg.Email.Redirect != nil {
+		emailSender, err = emailing.NewRedirectingSender(emailSender, cfg.Email.Redirect, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var attachments emailing.AttachmentStore
+	if cfg.Email.AttachmentsDir != "" {
+		attachments = emailing.NewFileAttachmentStore(cfg.Email.AttachmentsDir)
+	}
+	if cfg.Email.CheckTemplates {
+		inspector, err := emailing.NewSendgridTemplateInspector(cfg.Email.Credentials, cfg.Email.SendGrid)
+		if err != nil {
+			return nil, err
+		}
+		err = services.TemplatesChecker(cfg, inspector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Check suppressions against the original recipients
+	emailSuppressions := emailing.NewRedisSuppressionStore(keratinApp.RedisClient)
+	emailSender = emailing.NewSuppressingSender(emailSender, emailSuppressions, logger)
+	var emailArchive emailing.ArchiveStore
+	if cfg.Email.Archive != nil {
+		archiveConfig := *cfg.Email.Archive
+		// Tokens grant access to accounts so are never archived
+		archiveConfig.RedactParams = append(services.TokenParamNames(), archiveConfig.RedactParams...)
+		emailArchive = emailing.NewRedisArchiveStore(keratinApp.RedisClient, archiveConfig.Retention)
+		emailSender = emailing.NewArchivingSender(emailSender, emailArchive, &archiveConfig, logger)
+	}
+
+	for domain, brand := range cfg.Email.Brands {
+		if brand.Links == nil {
+			continue
+		}
+		if err = brand.Links.Validate(); err != nil {
+			return nil, fmt.Errorf("brand for %s: %v", domain, err)
+		}
+	}
+
+	var emailChecker *emailaddress.Checker
+	if cfg.Email.AddressChecks != nil {
+		emailChecker = emailaddress.NewChecker(cfg.Email.AddressChecks, net.DefaultResolver)
+	}
+
+	var emailWebhook *emailing.WebhookVerifier
+	if cfg.Email.EventWebhookKey != "" {
+		emailWebhook, err = emailing.NewWebhookVerifier(cfg.Email.EventWebhookKey, cfg.Email.EventWebhookTolerance)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	queue := redisq.NewFactory().RegisterQueue(cfg.TaskQ.QueueOptions)
 
 	err = queue.Consumer().Start(ctx)
@@ -69,12 +161,20 @@ func NewApp(cfg *config.Config, logger *logrus.Logger) (*App, error) {
 			Params:        params,
 			UserStore:     userStore,
 			EmailSender:   emailSender,
+			Attachments:   attachments,
 			ErrorReporter: errorReporter,
 			Logger:        logger,
 		}),
-		Logger: logger,
-		queue:  queue,
-		close:  cancel,
+		EmailEvents:       emailing.NewRedisEventStore(keratinApp.RedisClient, cfg.Email.EventRetention),
+		EmailWebhook:      emailWebhook,
+		EmailSuppressions: emailSuppressions,
+		EmailArchive:      emailArchive,
+		EmailChecker:      emailChecker,
+		EmailRenderer:     emailRenderer,
+		TokenRedemptions:  redemption.NewRedisStore(keratinApp.RedisClient),
+		Logger:            logger,
+		queue:             queue,
+		close:             cancel,
 	}, nil
 }
 
@@ -83,6 +183,8 @@ func DefaultDispatchers(args *services.DispatcherArgs) *Dispatchers {
 		SignupEmail:        services.SignupEmailDispatcher(args),
 		PasswordResetEmail: services.PasswordResetEmailDispatcher(args),
 		VerifyEmail:        services.VerifyEmailDispatcher(args),
+		EmailChanged:       services.EmailChangedDispatcher(args),
+		LoginEmail:         services.LoginEmailDispatcher(args),
 	}
 }
 
@@ -0,0 +1,154 @@
+package emailaddress
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Reasons an address is rejected by a Checker
+const (
+	Disposable   = "disposable"
+	NoMailServer = "no_mail_server"
+	Typo         = "typo"
+)
+
+// DefaultLookupTimeout bounds DNS lookups when no timeout is configured
+const DefaultLookupTimeout = 3 * time.Second
+
+// CheckerConfig selects the address quality checks made at signup
+type CheckerConfig struct {
+	// Reject addresses at known disposable domains
+	BlockDisposable bool
+	// Domains rejected in addition to the built in disposable domain list
+	DisposableDomains []string
+	// Reject addresses whose domain has no MX, A or AAAA record
+	CheckMailServers bool
+	// Reject addresses whose domain looks like a typo of a common email domain, suggesting the correction
+	SuggestTypos bool
+	// Domains never reported as typos in addition to the built in list of legitimate lookalike domains
+	TypoAllowedDomains []string
+	LookupTimeout      time.Duration
+}
+
+// Resolver looks up the DNS records that show a domain accepts mail, it is satisfied by net.Resolver
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// QualityError explains why a Checker rejected an address
+type QualityError struct {
+	Reason string
+	// The corrected address for typos
+	Suggestion string
+}
+
+// Error returns the reason as an error code in the style of keratin's, e.g. 'TYPO'. The suggestion is left for
+// callers to report separately.
+func (e *QualityError) Error() string {
+	return strings.ToUpper(e.Reason)
+}
+
+// Checker rejects addresses that are unlikely to reach a person who will keep using them
+type Checker struct {
+	config      CheckerConfig
+	resolver    Resolver
+	disposable  map[string]bool
+	typoAllowed map[string]bool
+}
+
+// NewChecker returns a Checker making the checks selected by cfg with DNS lookups through resolver
+func NewChecker(cfg *CheckerConfig, resolver Resolver) *Checker {
+	disposable := make(map[string]bool, len(disposableDomains)+len(cfg.DisposableDomains))
+	for _, domains := range [][]string{disposableDomains, cfg.DisposableDomains} {
+		for _, d := range domains {
+			disposable[strings.ToLower(d)] = true
+		}
+	}
+	typoAllowed := make(map[string]bool, len(cfg.TypoAllowedDomains))
+	for _, d := range cfg.TypoAllowedDomains {
+		typoAllowed[strings.ToLower(d)] = true
+	}
+	config := *cfg
+	if config.LookupTimeout <= 0 {
+		config.LookupTimeout = DefaultLookupTimeout
+	}
+	return &Checker{
+		config:      config,
+		resolver:    resolver,
+		disposable:  disposable,
+		typoAllowed: typoAllowed,
+	}
+}
+
+// Check returns a *QualityError if the normalized address fails a check. Typos are only checked when allowTypos is
+// false so that users can confirm a suggestion was wrong. Other errors mean a check could not be made and are
+// returned so the caller can decide whether to fail open.
+func (c *Checker) Check(address string, allowTypos bool) error {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ErrInvalid
+	}
+	local, domain := address[:at], strings.ToLower(address[at+1:])
+
+	if c.config.BlockDisposable && c.isDisposable(domain) {
+		return &QualityError{Reason: Disposable}
+	}
+	if c.config.SuggestTypos && !allowTypos && !c.typoAllowed[domain] {
+		if suggestion, ok := SuggestDomain(domain); ok {
+			return &QualityError{Reason: Typo, Suggestion: local + "@" + suggestion}
+		}
+	}
+	if c.config.CheckMailServers {
+		ok, err := c.acceptsMail(domain)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &QualityError{Reason: NoMailServer}
+		}
+	}
+	return nil
+}
+
+// isDisposable matches domain and its parent domains since disposable services often use arbitrary subdomains
+func (c *Checker) isDisposable(domain string) bool {
+	for {
+		if c.disposable[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// acceptsMail looks for an MX record falling back to an address record as mail servers do (RFC 5321 section 5.1)
+func (c *Checker) acceptsMail(domain string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.LookupTimeout)
+	defer cancel()
+
+	mxs, err := c.resolver.LookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+	if len(mxs) > 0 {
+		// A single '.' is a null MX (RFC 7505) declaring that the domain accepts no mail
+		return !(len(mxs) == 1 && mxs[0].Host == "."), nil
+	}
+	hosts, err := c.resolver.LookupHost(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+	return len(hosts) > 0, nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,110 @@
+package emailaddress
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticResolver answers from fixed records, any other name is not found
+type staticResolver struct {
+	mx    map[string][]*net.MX
+	hosts map[string][]string
+}
+
+func (r *staticResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if mx, ok := r.mx[name]; ok {
+		return mx, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *staticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if hosts, ok := r.hosts[host]; ok {
+		return hosts, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestChecker(t *testing.T) {
+	checker := NewChecker(&CheckerConfig{
+		BlockDisposable:   true,
+		DisposableDomains: []string{"throwaway.example"},
+		CheckMailServers:  true,
+		SuggestTypos:      true,
+	}, &staticResolver{
+		mx: map[string][]*net.MX{
+			"monax.io":       {{Host: "mx.monax.io", Pref: 10}},
+			"gmail.com":      {{Host: "gmail-smtp-in.l.google.com", Pref: 5}},
+			"gmial.com":      {{Host: "mx.gmial.com", Pref: 10}},
+			"nomail.example": {{Host: ".", Pref: 0}},
+		},
+		hosts: map[string][]string{
+			"direct.example": {"192.0.2.1"},
+		},
+	})
+
+	for address, reason := range map[string]string{
+		"cora@monax.io":            "",
+		"cora@gmail.com":           "",
+		"cora@direct.example":      "",
+		"cora@mailinator.com":      Disposable,
+		"cora@x.mailinator.com":    Disposable,
+		"cora@throwaway.example":   Disposable,
+		"cora@gmial.com":           Typo,
+		"cora@nomail.example":      NoMailServer,
+		"cora@nonexistent.example": NoMailServer,
+	} {
+		err := checker.Check(address, false)
+		if reason == "" {
+			assert.NoError(t, err, "checking %s", address)
+			continue
+		}
+		qualityErr, ok := err.(*QualityError)
+		require.True(t, ok, "checking %s: expected QualityError but got %v", address, err)
+		assert.Equal(t, reason, qualityErr.Reason, "checking %s", address)
+	}
+
+	err := checker.Check("cora@gmial.com", false)
+	assert.Equal(t, "cora@gmail.com", err.(*QualityError).Suggestion)
+	assert.Equal(t, "TYPO", err.Error())
+	assert.NoError(t, checker.Check("cora@gmial.com", true), "typos can be confirmed")
+}
+
+func TestCheckerTypoAllowedDomains(t *testing.T) {
+	checker := NewChecker(&CheckerConfig{
+		SuggestTypos:       true,
+		TypoAllowedDomains: []string{"Gmai.com"},
+	}, nil)
+	assert.NoError(t, checker.Check("cora@gmai.com", false))
+	assert.NoError(t, checker.Check("cora@ymail.com", false))
+	assert.Error(t, checker.Check("cora@gmial.com", false))
+}
+
+func TestSuggestDomain(t *testing.T) {
+	for domain, expected := range map[string]string{
+		"gmial.com":   "gmail.com",
+		"gmai.com":    "gmail.com",
+		"gmail.con":   "gmail.com",
+		"hotmial.com": "hotmail.com",
+		"yahooo.com":  "yahoo.com",
+		"outlok.com":  "outlook.com",
+		"monax.cmo":   "monax.com",
+		"gmail.com":   "",
+		"monax.io":    "",
+		"max.com":     "",
+		"love.com":    "",
+		"ymail.com":   "",
+		"email.com":   "",
+		"gmx.net":     "",
+		"hotmail.de":  "",
+		"yahoo.de":    "",
+	} {
+		suggestion, ok := SuggestDomain(domain)
+		assert.Equal(t, expected != "", ok, "suggesting for %s", domain)
+		assert.Equal(t, expected, suggestion, "suggesting for %s", domain)
+	}
+}
@@ -0,0 +1,194 @@
+package emailaddress
+
+import "strings"
+
+// disposableDomains are well known disposable and temporary email services. Subdomains of these are also matched.
+// Keep sorted, and add deployment specific domains with CheckerConfig.DisposableDomains.
+var disposableDomains = []string{
+	"10minutemail.com",
+	"10minutemail.net",
+	"20minutemail.com",
+	"33mail.com",
+	"anonbox.net",
+	"burnermail.io",
+	"discard.email",
+	"dispostable.com",
+	"dropmail.me",
+	"emailondeck.com",
+	"fakeinbox.com",
+	"getairmail.com",
+	"getnada.com",
+	"guerrillamail.biz",
+	"guerrillamail.com",
+	"guerrillamail.de",
+	"guerrillamail.info",
+	"guerrillamail.net",
+	"guerrillamail.org",
+	"guerrillamailblock.com",
+	"harakirimail.com",
+	"inboxbear.com",
+	"incognitomail.org",
+	"jetable.org",
+	"mailcatch.com",
+	"maildrop.cc",
+	"mailinator.com",
+	"mailinator.net",
+	"mailnesia.com",
+	"mintemail.com",
+	"moakt.com",
+	"mohmal.com",
+	"mytemp.email",
+	"mytrashmail.com",
+	"nada.email",
+	"sharklasers.com",
+	"spam4.me",
+	"spambox.us",
+	"spamgourmet.com",
+	"temp-mail.io",
+	"temp-mail.org",
+	"tempail.com",
+	"tempinbox.com",
+	"tempmail.dev",
+	"tempmail.net",
+	"tempmailo.com",
+	"tempr.email",
+	"throwawaymail.com",
+	"trashmail.com",
+	"trashmail.de",
+	"trashmail.net",
+	"yopmail.com",
+	"yopmail.fr",
+	"yopmail.net",
+}
+
+// commonDomains are popular email domains that typos are corrected to
+var commonDomains = []string{
+	"aol.com",
+	"comcast.net",
+	"gmail.com",
+	"gmx.com",
+	"gmx.de",
+	"googlemail.com",
+	"hotmail.co.uk",
+	"hotmail.com",
+	"hotmail.fr",
+	"icloud.com",
+	"live.com",
+	"mac.com",
+	"mail.com",
+	"me.com",
+	"msn.com",
+	"outlook.com",
+	"proton.me",
+	"protonmail.com",
+	"yahoo.co.uk",
+	"yahoo.com",
+	"yahoo.fr",
+	"yandex.ru",
+}
+
+// legitimateDomains are real email domains close enough to a common domain to look like typos of it, they are never
+// corrected. Keep sorted, and add deployment specific domains with CheckerConfig.TypoAllowedDomains.
+var legitimateDomains = []string{
+	"aim.com",
+	"email.com",
+	"gmx.com",
+	"gmx.de",
+	"gmx.net",
+	"googlemail.com",
+	"hotmail.de",
+	"hotmail.es",
+	"hotmail.it",
+	"live.co.uk",
+	"live.fr",
+	"mail.com",
+	"mail.ru",
+	"me.com",
+	"yahoo.de",
+	"yahoo.es",
+	"yahoo.it",
+	"ymail.com",
+}
+
+// Top level domain typos that are corrected regardless of the rest of the domain
+var tldTypos = map[string]string{
+	"cmo":  "com",
+	"con":  "com",
+	"comm": "com",
+	"cpm":  "com",
+	"ocm":  "com",
+	"vom":  "com",
+	"nte":  "net",
+	"ner":  "net",
+	"ogr":  "org",
+	"orgg": "org",
+}
+
+// SuggestDomain returns the common email domain that domain is probably a typo of. Common and known legitimate
+// domains are never typos.
+func SuggestDomain(domain string) (string, bool) {
+	domain = strings.ToLower(domain)
+	for _, domains := range [][]string{commonDomains, legitimateDomains} {
+		for _, d := range domains {
+			if d == domain {
+				return "", false
+			}
+		}
+	}
+
+	if dot := strings.LastIndex(domain, "."); dot >= 0 {
+		if tld, ok := tldTypos[domain[dot+1:]]; ok {
+			corrected := domain[:dot+1] + tld
+			if suggestion, ok := SuggestDomain(corrected); ok {
+				return suggestion, true
+			}
+			return corrected, true
+		}
+	}
+
+	best, bestDistance := "", 0
+	for _, d := range commonDomains {
+		distance := editDistance(domain, d)
+		// Allow an edit for longer domains but none for short ones where a single edit often gives a real domain
+		if distance <= (len(d)-3)/6 && (best == "" || distance < bestDistance) {
+			best, bestDistance = d, distance
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance is the optimal string alignment distance between a and b, i.e. the number of insertions, deletions,
+// substitutions and transpositions of adjacent characters needed to turn a into b
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
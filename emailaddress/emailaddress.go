@@ -0,0 +1,83 @@
+package emailaddress
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalid is returned for strings that cannot be normalized to a deliverable address
+var ErrInvalid = errors.New("not a valid email address")
+
+// Matches for all domains in a Policy
+const AnyDomain = "*"
+
+// worried about an imperfect regex? see: http://www.regular-expressions.info/email.html
+var (
+	localPattern = regexp.MustCompile(`(?i)\A[A-Z0-9._%+'-]{1,64}\z`)
+	// Matches ASCII (i.e. IDNA-encoded) domains which may have an IDNA-encoded top level domain
+	domainPattern = regexp.MustCompile(`(?i)\A(?:[A-Z0-9](?:[A-Z0-9-]{0,61}[A-Z0-9])?\.)+` +
+		`(?:[A-Z]{2,63}|XN--[A-Z0-9-]{1,59})\z`)
+)
+
+// Normalize trims surrounding whitespace from address and lowercases and IDNA-encodes its domain. The local part is
+// kept as given since mail servers may treat it case-sensitively, use Policy.Key to compare addresses.
+func Normalize(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	// SECURITY: the len() check prevents a regex ddos via overly large addresses
+	if len(address) >= 255 {
+		return "", ErrInvalid
+	}
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return "", ErrInvalid
+	}
+	local := address[:at]
+	domain, err := idna.Lookup.ToASCII(address[at+1:])
+	if err != nil || !localPattern.MatchString(local) || !domainPattern.MatchString(domain) {
+		return "", ErrInvalid
+	}
+	return local + "@" + strings.ToLower(domain), nil
+}
+
+// Policy configures how addresses that reach the same mailbox are folded together. Providers differ in which
+// variations of the local part they deliver to the same mailbox so these are configured per domain.
+type Policy struct {
+	// Domains for which a '+' and everything after it in the local part is ignored, or AnyDomain
+	PlusAddressing []string
+	// Domains for which dots in the local part are ignored, e.g. 'gmail.com', or AnyDomain
+	DotFolding []string
+}
+
+// Key returns the canonical form of a normalized address used to look up and deduplicate accounts: the local part
+// is lowercased and plus-addressing tags and dots are removed for the domains configured. A nil Policy only
+// lowercases.
+func (p *Policy) Key(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return strings.ToLower(address)
+	}
+	local, domain := strings.ToLower(address[:at]), address[at+1:]
+	if p != nil {
+		if matchDomain(p.PlusAddressing, domain) {
+			if plus := strings.Index(local, "+"); plus > 0 {
+				local = local[:plus]
+			}
+		}
+		if matchDomain(p.DotFolding, domain) {
+			local = strings.Replace(local, ".", "", -1)
+		}
+	}
+	return local + "@" + domain
+}
+
+func matchDomain(domains []string, domain string) bool {
+	for _, d := range domains {
+		if d == AnyDomain || strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
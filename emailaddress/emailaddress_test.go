@@ -0,0 +1,46 @@
+package emailaddress
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	for address, expected := range map[string]string{
+		"  Cora@Monax.IO ":     "Cora@monax.io",
+		"josé@bücher.example":  "",
+		"jose@Bücher.example":  "jose@xn--bcher-kva.example",
+		"ivan@пример.рф":       "ivan@xn--e1afmkfd.xn--p1ai",
+		"o'brien+tag@monax.io": "o'brien+tag@monax.io",
+		"cora@monax":           "",
+		"cora.monax.io":        "",
+		"cora@@monax.io":       "",
+		"@monax.io":            "",
+	} {
+		normalized, err := Normalize(address)
+		if expected == "" {
+			assert.Equal(t, ErrInvalid, err, "normalizing %q", address)
+			continue
+		}
+		assert.NoError(t, err, "normalizing %q", address)
+		assert.Equal(t, expected, normalized, "normalizing %q", address)
+	}
+}
+
+func TestPolicyKey(t *testing.T) {
+	policy := &Policy{
+		PlusAddressing: []string{AnyDomain},
+		DotFolding:     []string{"gmail.com"},
+	}
+	for address, expected := range map[string]string{
+		"Cora.Smith+signup@gmail.com": "corasmith@gmail.com",
+		"Cora.Smith+signup@monax.io":  "cora.smith@monax.io",
+		"+cora@monax.io":              "+cora@monax.io",
+	} {
+		assert.Equal(t, expected, policy.Key(address), "key for %q", address)
+	}
+
+	var none *Policy
+	assert.Equal(t, "cora.smith+signup@gmail.com", none.Key("Cora.Smith+signup@gmail.com"))
+}
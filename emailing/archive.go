@@ -0,0 +1,261 @@
+package emailing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/sirupsen/logrus"
+)
+
+// Outcome is what happened when we tried to send a message
+type Outcome string
+
+// all known outcomes
+const (
+	OutcomeSent        Outcome = "sent"
+	OutcomeSuppressed  Outcome = "suppressed"
+	OutcomeRateLimited Outcome = "rate_limited"
+	OutcomeFailed      Outcome = "failed"
+)
+
+// Replaces redacted template variables in archived bodies
+const redacted = "[REDACTED]"
+
+// ArchiveConfig controls what is kept of messages we send
+type ArchiveConfig struct {
+	// How long archived messages are kept
+	Retention time.Duration
+	// Keep recipient addresses as well as their hashes
+	StoreAddresses bool
+	// Keep the message as handed to the provider, with RedactParams and (unless StoreAddresses) addresses redacted
+	StoreBodies bool
+	// Template variables whose values are redacted from stored bodies
+	RedactParams []string
+}
+
+// ArchivedMessage records an attempt to send a message for support lookups
+type ArchivedMessage struct {
+	// Our message ID as set by WithTracking, each attempt by a job has its own
+	MessageID string    `json:"message_id"`
+	Timestamp time.Time `json:"timestamp"`
+	// JobID is the dispatcher job that sent the message, shared by each of its attempts
+	JobID string `json:"job_id,omitempty"`
+	// Task is the kind of job that sent the message
+	Task       string  `json:"task,omitempty"`
+	Purpose    Purpose `json:"purpose,omitempty"`
+	TemplateID string  `json:"template_id,omitempty"`
+	AccountID  int     `json:"account_id,omitempty"`
+	// Hashes of the recipients as returned by RecipientHash
+	RecipientHashes []string `json:"recipient_hashes"`
+	Recipients      []string `json:"recipients,omitempty"`
+	// Set once the provider reports events for the message
+	ProviderMessageID string  `json:"provider_message_id,omitempty"`
+	Outcome           Outcome `json:"outcome"`
+	Error             string  `json:"error,omitempty"`
+	// The provider request body with sensitive values redacted
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// ArchiveStore keeps archived messages
+type ArchiveStore interface {
+	Archive(message *ArchivedMessage) error
+	// SetProviderMessageID records the provider's ID for a message we archived
+	SetProviderMessageID(messageID, providerMessageID string) error
+	// FindArchivedByAccountID returns messages concerning an account in time order
+	FindArchivedByAccountID(accountID int) ([]*ArchivedMessage, error)
+	// FindArchivedByRecipient returns messages sent to address in time order
+	FindArchivedByRecipient(address string) ([]*ArchivedMessage, error)
+}
+
+// RecipientHash identifies an address in the archive without storing it
+func RecipientHash(address string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(address))))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewArchivingSender wraps sender so that every message and the outcome of sending it is archived. Failing to
+// archive is logged rather than failing the send.
+func NewArchivingSender(sender Sender, store ArchiveStore, cfg *ArchiveConfig, logger logrus.FieldLogger) Sender {
+	logger = logger.WithField("scope", "ArchivingSender")
+	return func(email *mail.SGMailV3) error {
+		// Capture the message before inner senders (such as redirection) modify it
+		message := archivedMessage(email, cfg)
+		err := sender(email)
+		message.Outcome = outcome(err)
+		if err != nil {
+			message.Error = err.Error()
+		}
+		if archiveErr := store.Archive(message); archiveErr != nil {
+			logger.WithError(archiveErr).WithField("message_id", message.MessageID).Error("could not archive email")
+		}
+		return err
+	}
+}
+
+// ArchiveFromEvents records the provider message IDs reported in events
+func ArchiveFromEvents(store ArchiveStore, events []*Event) error {
+	for _, e := range events {
+		if e.MessageID == "" || e.ProviderMessageID == "" {
+			continue
+		}
+		err := store.SetProviderMessageID(e.MessageID, e.ProviderMessageID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func archivedMessage(email *mail.SGMailV3, cfg *ArchiveConfig) *ArchivedMessage {
+	tracking := MessageTracking(email)
+	message := &ArchivedMessage{
+		MessageID:  tracking.MessageID,
+		JobID:      tracking.JobID,
+		Timestamp:  time.Now(),
+		Task:       tracking.Task,
+		Purpose:    tracking.Purpose,
+		TemplateID: email.TemplateID,
+		AccountID:  tracking.AccountID,
+	}
+	for _, to := range ToAddresses(email) {
+		message.RecipientHashes = append(message.RecipientHashes, RecipientHash(to))
+		if cfg.StoreAddresses {
+			message.Recipients = append(message.Recipients, to)
+		}
+	}
+	if cfg.StoreBodies {
+		message.Body = redactedBody(email, cfg)
+	}
+	return message
+}
+
+func outcome(err error) Outcome {
+	var suppressed *SuppressedError
+	var rateLimited *RateLimitError
+	switch {
+	case err == nil:
+		return OutcomeSent
+	case errors.As(err, &suppressed):
+		return OutcomeSuppressed
+	case errors.As(err, &rateLimited):
+		return OutcomeRateLimited
+	default:
+		return OutcomeFailed
+	}
+}
+
+// redactedBody renders the provider request body for a copy of email with sensitive values replaced and attachment
+// content dropped
+func redactedBody(email *mail.SGMailV3, cfg *ArchiveConfig) json.RawMessage {
+	redactParams := make(map[string]bool, len(cfg.RedactParams))
+	for _, p := range cfg.RedactParams {
+		redactParams[p] = true
+	}
+	redactEmails := func(emails []*mail.Email) []*mail.Email {
+		if cfg.StoreAddresses {
+			return emails
+		}
+		redactedEmails := make([]*mail.Email, len(emails))
+		for i, e := range emails {
+			redactedEmails[i] = mail.NewEmail(redacted, RecipientHash(e.Address))
+		}
+		return redactedEmails
+	}
+
+	m := *email
+	m.Personalizations = make([]*mail.Personalization, len(email.Personalizations))
+	for i, p := range email.Personalizations {
+		rp := *p
+		rp.To = redactEmails(p.To)
+		rp.CC = redactEmails(p.CC)
+		rp.BCC = redactEmails(p.BCC)
+		rp.DynamicTemplateData = make(map[string]interface{}, len(p.DynamicTemplateData))
+		for k, v := range p.DynamicTemplateData {
+			if redactParams[k] || (k == OriginalRecipientParam && !cfg.StoreAddresses) {
+				v = redacted
+			}
+			rp.DynamicTemplateData[k] = v
+		}
+		m.Personalizations[i] = &rp
+	}
+	m.Attachments = make([]*mail.Attachment, len(email.Attachments))
+	for i, a := range email.Attachments {
+		ra := *a
+		ra.Content = ""
+		m.Attachments[i] = &ra
+	}
+	return mail.GetRequestBody(&m)
+}
+
+type memoryArchiveStore struct {
+	sync.RWMutex
+	messages    map[string]*ArchivedMessage
+	byAccount   map[int][]string
+	byRecipient map[string][]string
+}
+
+// NewMemoryArchiveStore returns an ArchiveStore that does not persist, useful for testing and development
+func NewMemoryArchiveStore() ArchiveStore {
+	return &memoryArchiveStore{
+		messages:    make(map[string]*ArchivedMessage),
+		byAccount:   make(map[int][]string),
+		byRecipient: make(map[string][]string),
+	}
+}
+
+func (s *memoryArchiveStore) Archive(message *ArchivedMessage) error {
+	s.Lock()
+	defer s.Unlock()
+	s.messages[message.MessageID] = message
+	if message.AccountID != 0 {
+		s.byAccount[message.AccountID] = append(s.byAccount[message.AccountID], message.MessageID)
+	}
+	for _, hash := range message.RecipientHashes {
+		s.byRecipient[hash] = append(s.byRecipient[hash], message.MessageID)
+	}
+	return nil
+}
+
+func (s *memoryArchiveStore) SetProviderMessageID(messageID, providerMessageID string) error {
+	s.Lock()
+	defer s.Unlock()
+	if message, ok := s.messages[messageID]; ok {
+		message.ProviderMessageID = providerMessageID
+	}
+	return nil
+}
+
+func (s *memoryArchiveStore) FindArchivedByAccountID(accountID int) ([]*ArchivedMessage, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.find(s.byAccount[accountID]), nil
+}
+
+func (s *memoryArchiveStore) FindArchivedByRecipient(address string) ([]*ArchivedMessage, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.find(s.byRecipient[RecipientHash(address)]), nil
+}
+
+func (s *memoryArchiveStore) find(messageIDs []string) []*ArchivedMessage {
+	messages := make([]*ArchivedMessage, len(messageIDs))
+	for i, id := range messageIDs {
+		message := *s.messages[id]
+		messages[i] = &message
+	}
+	return sortArchivedMessages(messages)
+}
+
+func sortArchivedMessages(messages []*ArchivedMessage) []*ArchivedMessage {
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(messages[j].Timestamp)
+	})
+	return messages
+}
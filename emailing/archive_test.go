@@ -0,0 +1,99 @@
+package emailing
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchivingSender(t *testing.T) {
+	archive := NewMemoryArchiveStore()
+	suppressions := NewMemorySuppressionStore()
+	err := suppressions.Suppress(&Suppression{Email: "bounced@monax.io", Reason: SuppressedBounce})
+	require.NoError(t, err)
+	sender := NewArchivingSender(NewSuppressingSender(func(email *mail.SGMailV3) error {
+		return nil
+	}, suppressions, logrus.New()), archive, &ArchiveConfig{
+		StoreBodies:  true,
+		RedactParams: []string{"token"},
+	}, logrus.New())
+
+	send := func(to string) *Tracking {
+		tracking := NewTracking("Test", PurposeSignup, 4)
+		m, err := NewMessage("template-1", to, mail.NewEmail("", "noreply@monax.io"),
+			testParams{"token": "secret", "name": "Cora"}, WithTracking(tracking))
+		require.NoError(t, err)
+		_ = sender(m)
+		return tracking
+	}
+	sent := send("Cora@monax.io")
+	send("bounced@monax.io")
+
+	messages, err := archive.FindArchivedByAccountID(4)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, OutcomeSent, messages[0].Outcome)
+	assert.Equal(t, OutcomeSuppressed, messages[1].Outcome)
+	assert.NotEmpty(t, messages[1].Error)
+
+	messages, err = archive.FindArchivedByRecipient("cora@monax.io")
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	message := messages[0]
+	assert.Equal(t, sent.MessageID, message.MessageID)
+	assert.Equal(t, PurposeSignup, message.Purpose)
+	assert.Empty(t, message.Recipients)
+	assert.NotContains(t, string(message.Body), "secret")
+	assert.NotContains(t, string(message.Body), "Cora@monax.io")
+
+	body := new(struct {
+		Personalizations []struct {
+			DynamicTemplateData map[string]interface{} `json:"dynamic_template_data"`
+		} `json:"personalizations"`
+	})
+	require.NoError(t, json.Unmarshal(message.Body, body))
+	assert.Equal(t, redacted, body.Personalizations[0].DynamicTemplateData["token"])
+	assert.Equal(t, "Cora", body.Personalizations[0].DynamicTemplateData["name"])
+
+	err = ArchiveFromEvents(archive, []*Event{{MessageID: sent.MessageID, ProviderMessageID: "sg-1"}})
+	require.NoError(t, err)
+	messages, err = archive.FindArchivedByRecipient("cora@monax.io")
+	require.NoError(t, err)
+	assert.Equal(t, "sg-1", messages[0].ProviderMessageID)
+}
+
+func TestArchivingSenderRetries(t *testing.T) {
+	archive := NewMemoryArchiveStore()
+	fail := true
+	sender := NewArchivingSender(func(email *mail.SGMailV3) error {
+		if fail {
+			fail = false
+			return errors.New("connection reset")
+		}
+		return nil
+	}, archive, &ArchiveConfig{}, logrus.New())
+
+	// Each attempt by the job forms its message afresh
+	for i := 0; i < 2; i++ {
+		tracking := NewTracking("Test", PurposeSignup, 4)
+		tracking.JobID = "job-1"
+		m, err := NewMessage("template-1", "cora@monax.io", mail.NewEmail("", "noreply@monax.io"),
+			testParams{"name": "Cora"}, WithTracking(tracking))
+		require.NoError(t, err)
+		_ = sender(m)
+	}
+
+	messages, err := archive.FindArchivedByAccountID(4)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, OutcomeFailed, messages[0].Outcome)
+	assert.Equal(t, OutcomeSent, messages[1].Outcome)
+	assert.NotEqual(t, messages[0].MessageID, messages[1].MessageID)
+	assert.Equal(t, "job-1", messages[0].JobID)
+	assert.Equal(t, "job-1", messages[1].JobID)
+}
@@ -0,0 +1,143 @@
+package emailing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Attachment dispositions
+const (
+	DispositionAttachment = "attachment"
+	DispositionInline     = "inline"
+)
+
+// DefaultMaxAttachmentSize bounds the total size of a message's attachments when no limit is configured. SendGrid
+// accepts messages of up to 30MB.
+const DefaultMaxAttachmentSize = 20 << 20
+
+// Attachment is a file sent with a message. Exactly one of Content or Location should be set: small content can be
+// carried in the Attachment, but large content should be left in storage and referenced by Location so that it is
+// not carried in queue messages.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	// DispositionAttachment (the default) or DispositionInline
+	Disposition string
+	// ContentID identifies an inline attachment so it can be referenced from HTML as 'cid:<ContentID>'
+	ContentID string
+	Content   []byte
+	// Location is passed to an AttachmentStore to read the content when the message is sent
+	Location string
+}
+
+// PurposeAttachments maps purposes to the attachments configured for their messages, such as a logo referenced from
+// templates as 'cid:<ContentID>'
+type PurposeAttachments map[Purpose][]*Attachment
+
+// AttachmentStore reads attachment content from storage
+type AttachmentStore interface {
+	Open(location string) (io.ReadCloser, error)
+}
+
+// AttachmentTooLargeError is returned when attachments exceed the configured limit
+type AttachmentTooLargeError struct {
+	Filename string
+	Limit    int64
+}
+
+func (e *AttachmentTooLargeError) Error() string {
+	return fmt.Sprintf("attachment %s takes message attachments over the limit of %d bytes", e.Filename, e.Limit)
+}
+
+// Permanent marks this as a failure that retrying will not resolve
+func (e *AttachmentTooLargeError) Permanent() bool {
+	return true
+}
+
+// WithAttachments adds attachments to a message, reading content referenced by Location from store when the
+// message is formed. The total size of the attachments may not exceed maxSize, or DefaultMaxAttachmentSize if
+// maxSize is not positive.
+func WithAttachments(store AttachmentStore, maxSize int64, attachments ...*Attachment) Option {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxAttachmentSize
+	}
+	return func(m *mail.SGMailV3) error {
+		remaining := maxSize
+		for _, a := range attachments {
+			content, n, err := encodeAttachment(store, a, remaining)
+			if err != nil {
+				return err
+			}
+			remaining -= n
+			disposition := a.Disposition
+			if disposition == "" {
+				disposition = DispositionAttachment
+			}
+			m.AddAttachment(&mail.Attachment{
+				Content:     content,
+				Type:        a.ContentType,
+				Filename:    a.Filename,
+				Disposition: disposition,
+				ContentID:   a.ContentID,
+			})
+		}
+		return nil
+	}
+}
+
+// encodeAttachment base64 encodes the content of a, reading no more than limit bytes. The provider API takes content
+// inline in the message so the encoded content is held in memory, the limit bounds how much.
+func encodeAttachment(store AttachmentStore, a *Attachment, limit int64) (string, int64, error) {
+	var r io.Reader
+	if a.Location != "" {
+		if store == nil {
+			return "", 0, fmt.Errorf("attachment %s references %s but no attachment store is configured",
+				a.Filename, a.Location)
+		}
+		rc, err := store.Open(a.Location)
+		if err != nil {
+			return "", 0, fmt.Errorf("could not open attachment %s: %v", a.Filename, err)
+		}
+		defer rc.Close()
+		r = rc
+	} else {
+		r = bytes.NewReader(a.Content)
+	}
+
+	sb := new(strings.Builder)
+	encoder := base64.NewEncoder(base64.StdEncoding, sb)
+	// Read one more byte than allowed to detect content over the limit
+	n, err := io.Copy(encoder, io.LimitReader(r, limit+1))
+	if err != nil {
+		return "", 0, fmt.Errorf("could not read attachment %s: %v", a.Filename, err)
+	}
+	if n > limit {
+		return "", 0, &AttachmentTooLargeError{Filename: a.Filename, Limit: limit}
+	}
+	err = encoder.Close()
+	if err != nil {
+		return "", 0, err
+	}
+	return sb.String(), n, nil
+}
+
+type fileAttachmentStore struct {
+	dir string
+}
+
+// NewFileAttachmentStore returns an AttachmentStore reading locations as paths relative to dir
+func NewFileAttachmentStore(dir string) AttachmentStore {
+	return &fileAttachmentStore{dir: dir}
+}
+
+func (s *fileAttachmentStore) Open(location string) (io.ReadCloser, error) {
+	// Clean as an absolute path first so that the location cannot escape dir
+	return os.Open(filepath.Join(s.dir, filepath.Clean("/"+location)))
+}
@@ -0,0 +1,66 @@
+package emailing
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAttachments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attachments")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	export := []byte(`{"email": "cora@monax.io"}`)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "export.json"), export, 0600))
+	store := NewFileAttachmentStore(dir)
+
+	logo := &Attachment{
+		Filename:    "logo.png",
+		ContentType: "image/png",
+		Disposition: DispositionInline,
+		ContentID:   "logo",
+		Content:     []byte("not really a png"),
+	}
+	exportAttachment := &Attachment{
+		Filename:    "export.json",
+		ContentType: "application/json",
+		Location:    "export.json",
+	}
+
+	t.Run("attaches content and content from storage", func(t *testing.T) {
+		m := mail.NewV3Mail()
+		err := WithAttachments(store, DefaultMaxAttachmentSize, logo, exportAttachment)(m)
+		require.NoError(t, err)
+		require.Len(t, m.Attachments, 2)
+		assert.Equal(t, "logo", m.Attachments[0].ContentID)
+		assert.Equal(t, DispositionInline, m.Attachments[0].Disposition)
+		assert.Equal(t, DispositionAttachment, m.Attachments[1].Disposition)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(export), m.Attachments[1].Content)
+	})
+
+	t.Run("enforces the size limit across attachments", func(t *testing.T) {
+		err := WithAttachments(store, int64(len(export)+1), logo, exportAttachment)(mail.NewV3Mail())
+		assert.IsType(t, &AttachmentTooLargeError{}, err)
+	})
+
+	t.Run("locations cannot escape the store", func(t *testing.T) {
+		f, err := store.Open("reports/../export.json")
+		require.NoError(t, err)
+		f.Close()
+		_, err = store.Open("../" + filepath.Base(dir) + "/export.json")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestWithAttachmentsDefaultLimit(t *testing.T) {
+	m := mail.NewV3Mail()
+	err := WithAttachments(nil, 0, &Attachment{Filename: "logo.png", Content: []byte("logo")})(m)
+	require.NoError(t, err)
+	assert.Len(t, m.Attachments, 1)
+}
@@ -0,0 +1,77 @@
+package emailing
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Brand is the identity email is sent under for one application domain. Anything left unset falls back to the
+// default configuration.
+type Brand struct {
+	From *mail.Email
+	// Templates for this brand, purposes missing from the map use the default templates
+	Templates Templates
+	// Localised templates for this brand keyed by BCP 47 language tag
+	LocalizedTemplates map[string]Templates
+	// Pages of the brand's front end that links in email lead to
+	Links *Links
+	// Attachments sent with messages of each purpose under the brand, purposes missing from the map use the default
+	// attachments
+	Attachments PurposeAttachments
+}
+
+// Links are the absolute URLs of the front end pages that links in email lead to, each link carries its token as the
+// 'token' query parameter. Pages left unset link to the default front end.
+type Links struct {
+	CompleteSignup string
+	// Used for every kind of password reset message
+	PasswordReset string
+	VerifyEmail   string
+	// Used for notices of an email change, where the link reverts the change
+	RevertEmail string
+	Login       string
+}
+
+// Validate checks that every page set is an absolute URL
+func (l *Links) Validate() error {
+	for _, page := range []string{l.CompleteSignup, l.PasswordReset, l.VerifyEmail, l.RevertEmail, l.Login} {
+		if page == "" {
+			continue
+		}
+		u, err := url.Parse(page)
+		if err != nil || !u.IsAbs() {
+			return fmt.Errorf("email link %s is not an absolute URL", page)
+		}
+	}
+	return nil
+}
+
+// Link returns the link carrying token to the page for messages of purpose, or false if no page is set for it
+func (l *Links) Link(purpose Purpose, token string) (string, bool) {
+	var page string
+	switch purpose {
+	case PurposeSignup:
+		page = l.CompleteSignup
+	case PurposePasswordReset, PurposePasswordResetNewUser, PurposePasswordResetExpired:
+		page = l.PasswordReset
+	case PurposeVerifyEmail:
+		page = l.VerifyEmail
+	case PurposeEmailChangeNotice:
+		page = l.RevertEmail
+	case PurposeLogin:
+		page = l.Login
+	}
+	if page == "" {
+		return "", false
+	}
+	u, err := url.Parse(page)
+	if err != nil {
+		return "", false
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), true
+}
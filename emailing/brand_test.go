@@ -0,0 +1,29 @@
+package emailing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinks(t *testing.T) {
+	links := &Links{
+		CompleteSignup: "https://brand.example/app/signup",
+		PasswordReset:  "https://brand.example/reset?ref=email",
+	}
+	assert.NoError(t, links.Validate())
+
+	link, ok := links.Link(PurposeSignup, "a.b+c")
+	assert.True(t, ok)
+	assert.Equal(t, "https://brand.example/app/signup?token=a.b%2Bc", link)
+	for _, purpose := range []Purpose{PurposePasswordReset, PurposePasswordResetNewUser, PurposePasswordResetExpired} {
+		link, ok = links.Link(purpose, "t")
+		assert.True(t, ok)
+		assert.Equal(t, "https://brand.example/reset?ref=email&token=t", link)
+	}
+	_, ok = links.Link(PurposeLogin, "t")
+	assert.False(t, ok, "unset pages use the default front end")
+
+	assert.Error(t, (&Links{Login: "/login"}).Validate())
+	assert.Error(t, (&Links{Login: "https://brand.example/%zz"}).Validate())
+}
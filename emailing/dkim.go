@@ -0,0 +1,155 @@
+package emailing
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/toorop/go-dkim"
+)
+
+// DefaultDKIMHeaders are the header fields signed when none are configured. From is always signed.
+var DefaultDKIMHeaders = []string{
+	"From", "Reply-To", "To", "Cc", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type",
+}
+
+// DKIMKey is an RSA signing key published in DNS as a TXT record at <Selector>._domainkey.<Domain>
+type DKIMKey struct {
+	Domain   string
+	Selector string
+	// PEM encoded PKCS #1 or PKCS #8 private key, or a file holding one
+	PrivateKey     string
+	PrivateKeyFile string
+	// When the key starts being used. To rotate keys publish the new selector and configure its key with
+	// ActiveFrom far enough ahead for DNS to propagate. The old key can be removed once the new one is active, but its
+	// DNS record should stay until mail signed with it has been delivered.
+	ActiveFrom time.Time
+}
+
+type DKIMConfig struct {
+	Keys []*DKIMKey
+	// Header fields to sign, defaults to DefaultDKIMHeaders
+	Headers []string
+	// How long signatures are valid for, zero for no expiry
+	Expiry time.Duration
+}
+
+// DKIMSigner signs messages with the active key for the domain of their From address
+type DKIMSigner struct {
+	// Keys for each domain, most recently active first
+	keys    map[string][]*dkimKey
+	headers []string
+	expiry  time.Duration
+}
+
+type dkimKey struct {
+	selector   string
+	pem        []byte
+	activeFrom time.Time
+}
+
+// NewDKIMSigner loads the keys in cfg returning an error if any cannot be read or parsed
+func NewDKIMSigner(cfg *DKIMConfig) (*DKIMSigner, error) {
+	signer := &DKIMSigner{
+		keys:    make(map[string][]*dkimKey),
+		headers: cfg.Headers,
+		expiry:  cfg.Expiry,
+	}
+	if len(signer.headers) == 0 {
+		signer.headers = DefaultDKIMHeaders
+	}
+	hasFrom := false
+	for _, h := range signer.headers {
+		hasFrom = hasFrom || strings.EqualFold(h, "From")
+	}
+	if !hasFrom {
+		// RFC 6376 section 5.4 requires From to be signed
+		signer.headers = append([]string{"From"}, signer.headers...)
+	}
+
+	for _, k := range cfg.Keys {
+		if k.Domain == "" || k.Selector == "" {
+			return nil, fmt.Errorf("DKIM keys need a domain and a selector")
+		}
+		key := []byte(k.PrivateKey)
+		if k.PrivateKeyFile != "" {
+			var err error
+			key, err = ioutil.ReadFile(k.PrivateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("could not read DKIM key %s for %s: %v", k.Selector, k.Domain, err)
+			}
+		}
+		err := checkRSAKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse DKIM key %s for %s: %v", k.Selector, k.Domain, err)
+		}
+		domain := strings.ToLower(k.Domain)
+		signer.keys[domain] = append(signer.keys[domain], &dkimKey{
+			selector:   k.Selector,
+			pem:        key,
+			activeFrom: k.ActiveFrom,
+		})
+	}
+	for _, keys := range signer.keys {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].activeFrom.After(keys[j].activeFrom)
+		})
+	}
+	return signer, nil
+}
+
+// Sign returns message with a DKIM-Signature header added using the key active at now for domain
+func (s *DKIMSigner) Sign(domain string, message []byte, now time.Time) ([]byte, error) {
+	key := s.activeKey(strings.ToLower(domain), now)
+	if key == nil {
+		return nil, fmt.Errorf("no active DKIM key for %s", domain)
+	}
+	options := dkim.NewSigOptions()
+	options.PrivateKey = key.pem
+	options.Domain = domain
+	options.Selector = key.selector
+	// The library lower cases the headers in place
+	options.Headers = append([]string(nil), s.headers...)
+	options.AddSignatureTimestamp = true
+	options.SignatureExpireIn = uint64(s.expiry / time.Second)
+
+	signed := append([]byte(nil), message...)
+	err := dkim.Sign(&signed, options)
+	if err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+func (s *DKIMSigner) activeKey(domain string, now time.Time) *dkimKey {
+	for _, key := range s.keys[domain] {
+		if !key.activeFrom.After(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+// checkRSAKey checks that key is a PEM encoded RSA private key as the signing library expects
+func checkRSAKey(key []byte) error {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return fmt.Errorf("not PEM encoded")
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	if _, ok := parsed.(*rsa.PrivateKey); !ok {
+		return fmt.Errorf("not an RSA key")
+	}
+	return nil
+}
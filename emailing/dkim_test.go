@@ -0,0 +1,159 @@
+package emailing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toorop/go-dkim"
+)
+
+// dkimKeys generates keys for selectors returning their PEM encoding and the DNS TXT records that publish them
+func dkimKeys(t *testing.T, domain string, selectors ...string) (map[string]string, map[string][]string) {
+	keys := make(map[string]string)
+	records := make(map[string][]string)
+	for _, selector := range selectors {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		require.NoError(t, err)
+		keys[selector] = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		}))
+		public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		require.NoError(t, err)
+		records[selector+"._domainkey."+domain] = []string{
+			"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(public),
+		}
+	}
+	return keys, records
+}
+
+// verifyDKIM checks the signature on message offline against records
+func verifyDKIM(message []byte, records map[string][]string) error {
+	status, err := dkim.Verify(&message, dkim.DNSOptLookupTXT(func(name string) ([]string, error) {
+		if record, ok := records[name]; ok {
+			return record, nil
+		}
+		return nil, fmt.Errorf("no TXT record for %s", name)
+	}))
+	if err != nil {
+		return err
+	}
+	if status != dkim.SUCCESS {
+		return fmt.Errorf("DKIM verification status %v", status)
+	}
+	return nil
+}
+
+func TestMIMESenderDKIM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "signup"), 0700))
+	for file, content := range map[string]string{
+		localSubjectFile: "Welcome {{.name}}\n",
+		localTextFile:    "Hi {{.name}}, complete your signup at {{.token_link}}",
+		localHTMLFile:    `<p>Hi {{.name}}, <a href="{{.token_link}}">complete your signup</a></p>`,
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "signup", file), []byte(content), 0600))
+	}
+
+	keys, records := dkimKeys(t, "example.com", "old", "new")
+	signer, err := NewDKIMSigner(&DKIMConfig{
+		Keys: []*DKIMKey{
+			{Domain: "example.com", Selector: "old", PrivateKey: keys["old"]},
+			{Domain: "example.com", Selector: "new", PrivateKey: keys["new"], ActiveFrom: time.Now().Add(time.Hour)},
+		},
+	})
+	require.NoError(t, err)
+
+	var messages [][]byte
+	var recipients []string
+	sender := NewMIMESender(NewLocalTemplates(dir), signer, func(from string, to []string, message []byte) error {
+		assert.Equal(t, "noreply@example.com", from)
+		recipients = append(recipients, to...)
+		messages = append(messages, message)
+		return nil
+	})
+
+	email := mail.NewV3Mail()
+	email.SetTemplateID("signup")
+	email.SetFrom(mail.NewEmail("Example", "noreply@example.com"))
+	p := mail.NewPersonalization()
+	p.AddTos(mail.NewEmail("", "user@example.net"))
+	p.DynamicTemplateData = map[string]interface{}{
+		"name":       "<Ada>",
+		"token_link": "https://example.com/signup?token=abc",
+	}
+	email.AddPersonalizations(p)
+	require.NoError(t, sender(email))
+
+	require.Len(t, messages, 1)
+	assert.Equal(t, []string{"user@example.net"}, recipients)
+	message := messages[0]
+	assert.Contains(t, string(message), "Subject: Welcome <Ada>\r\n")
+	assert.Contains(t, string(message), "&lt;Ada&gt;", "HTML bodies escape parameters")
+	assert.Contains(t, string(message), "s=old;", "the new key is not active yet")
+	require.NoError(t, verifyDKIM(message, records))
+
+	t.Run("rotated key", func(t *testing.T) {
+		unsigned, err := BuildMIME(email, p, time.Now())
+		require.NoError(t, err)
+		signed, err := signer.Sign("example.com", unsigned, time.Now().Add(2*time.Hour))
+		require.NoError(t, err)
+		assert.Contains(t, string(signed), "s=new;")
+		require.NoError(t, verifyDKIM(signed, records))
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := bytes.Replace(message, []byte("Subject: Welcome"), []byte("Subject: Hello"), 1)
+		assert.Error(t, verifyDKIM(tampered, records))
+	})
+
+	t.Run("unknown domain", func(t *testing.T) {
+		_, err := signer.Sign("example.org", message, time.Now())
+		assert.Error(t, err)
+	})
+}
+
+func TestDKIMSignerHeaders(t *testing.T) {
+	keys, records := dkimKeys(t, "example.com", "s1")
+	keyFile := filepath.Join(os.TempDir(), fmt.Sprintf("dkim-%d.pem", time.Now().UnixNano()))
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte(keys["s1"]), 0600))
+	defer os.Remove(keyFile)
+
+	signer, err := NewDKIMSigner(&DKIMConfig{
+		Keys:    []*DKIMKey{{Domain: "Example.com", Selector: "s1", PrivateKeyFile: keyFile}},
+		Headers: []string{"Subject", "Date"},
+	})
+	require.NoError(t, err)
+
+	email := mail.NewV3Mail()
+	email.SetFrom(mail.NewEmail("", "noreply@example.com"))
+	email.AddContent(mail.NewContent("text/plain", "Hello"))
+	p := mail.NewPersonalization()
+	p.AddTos(mail.NewEmail("", "user@example.net"))
+	email.AddPersonalizations(p)
+	message, err := BuildMIME(email, p, time.Now())
+	require.NoError(t, err)
+
+	signed, err := signer.Sign("example.com", message, time.Now())
+	require.NoError(t, err)
+	assert.Contains(t, string(signed), "h=from:subject:date;", "From is always signed")
+	require.NoError(t, verifyDKIM(signed, records))
+
+	_, err = NewDKIMSigner(&DKIMConfig{Keys: []*DKIMKey{{Domain: "example.com", Selector: "s1", PrivateKey: "key"}}})
+	assert.Error(t, err)
+}
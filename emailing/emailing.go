@@ -3,10 +3,12 @@ package emailing
 import (
 	"bytes"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/sirupsen/logrus"
 )
@@ -18,21 +20,26 @@ type SenderType int
 const (
 	Log SenderType = iota
 	SendGrid
+	SMTP
 )
 
-// NewErrorReporter will instantiate an ErrorReporter for a known type
-func NewSender(t SenderType, credentials string, logger logrus.FieldLogger) Sender {
+// NewSender returns the Sender for t. The SendGrid sender reaches the API as configured by sendgrid, which may be nil
+// for the defaults, and the SMTP sender requires smtp.
+func NewSender(t SenderType, credentials string, sendgrid *SendgridConfig, smtp *SMTPConfig,
+	logger logrus.FieldLogger) (Sender, error) {
 	logger = logger.WithField("scope", "NewEmailClient")
 	switch t {
 	case Log:
-		return NewLogSender(logger)
+		return NewLogSender(logger), nil
 	case SendGrid:
-		return NewSendgridSender(credentials)
+		return NewSendgridSender(credentials, sendgrid)
+	case SMTP:
+		return NewSMTPSender(smtp)
 	default:
 		return func(email *mail.SGMailV3) error {
 			_, err := fmt.Fprintf(os.Stderr, "send email %#v", email)
 			return err
-		}
+		}, nil
 	}
 }
 
@@ -44,6 +51,7 @@ func NewLogSender(logger logrus.FieldLogger) Sender {
 			"subject":     email.Subject,
 			"to":          strings.Join(ToAddresses(email), ", "),
 			"content":     Content(email),
+			"attachments": strings.Join(AttachmentNames(email), ", "),
 		}
 		for k, v := range TemplateData(email) {
 			fields[k] = v
@@ -53,39 +61,66 @@ func NewLogSender(logger logrus.FieldLogger) Sender {
 	}
 }
 
-func NewSendgridSender(credentials string) Sender {
-	emailClient := sendgrid.NewSendClient(credentials)
+// NewSendgridSender returns a Sender using the SendGrid API reached as configured by cfg, which may be nil for the
+// defaults
+func NewSendgridSender(credentials string, cfg *SendgridConfig) (Sender, error) {
+	client, err := newSendgridClient(credentials, cfg)
+	if err != nil {
+		return nil, err
+	}
 	return func(email *mail.SGMailV3) error {
-		resp, err := emailClient.Send(email)
+		req := client.request(rest.Post, "/v3/mail/send")
+		req.Body = mail.GetRequestBody(email)
+		if key := idempotencyKey(email); key != "" {
+			req.Headers[IdempotencyKeyHeader] = key
+		}
+		resp, err := client.client.Send(req)
 		if err != nil {
 			return err
 		}
 
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return &RateLimitError{RetryAfter: retryAfter(http.Header(resp.Headers), time.Now())}
+		}
 		if resp.StatusCode < 200 || resp.StatusCode > 299 {
 			return fmt.Errorf("SendGrid responsed with failure status: %v", resp)
 		}
 		return nil
-	}
+	}, nil
 }
 
 type Sender func(email *mail.SGMailV3) error
 
-func Send(sender Sender, templateID, to string, from *mail.Email, fields ...interface{}) error {
+// Send sends templateID rendered with params to a single recipient
+func Send(sender Sender, templateID, to string, from *mail.Email, params TemplateParams, opts ...Option) error {
+	m, err := NewMessage(templateID, to, from, params, opts...)
+	if err != nil {
+		return err
+	}
+	return sender(m)
+}
+
+// NewMessage builds the message for templateID rendered with params to a single recipient
+func NewMessage(templateID, to string, from *mail.Email, params TemplateParams,
+	opts ...Option) (*mail.SGMailV3, error) {
 	m := mail.NewV3Mail()
 	m.SetTemplateID(templateID)
 	m.SetFrom(from)
 
 	p := mail.NewPersonalization()
 	p.AddTos(mail.NewEmail("", to))
-	td, err := templateData(fields)
-	if err != nil {
-		return fmt.Errorf("could form email template data from fields passed: %v", err)
-	}
-	p.DynamicTemplateData = td
+	p.DynamicTemplateData = params.Params()
 
 	m.AddPersonalizations(p)
 
-	return sender(m)
+	for _, opt := range opts {
+		err := opt(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
 }
 
 func ToAddresses(m *mail.SGMailV3) []string {
@@ -98,6 +133,14 @@ func ToAddresses(m *mail.SGMailV3) []string {
 	return tos
 }
 
+func AttachmentNames(m *mail.SGMailV3) []string {
+	names := make([]string, len(m.Attachments))
+	for i, a := range m.Attachments {
+		names[i] = fmt.Sprintf("%s (%s, %s)", a.Filename, a.Type, a.Disposition)
+	}
+	return names
+}
+
 func TemplateData(m *mail.SGMailV3) map[string]interface{} {
 	td := make(map[string]interface{})
 	for _, p := range m.Personalizations {
@@ -118,19 +161,3 @@ func Content(m *mail.SGMailV3) string {
 	}
 	return buf.String()
 }
-
-func templateData(fields []interface{}) (map[string]interface{}, error) {
-	if len(fields)%2 != 0 {
-		return nil, fmt.Errorf("fields passed to email template must be list of key-value pairs")
-	}
-	m := make(map[string]interface{}, len(fields)/2)
-	for i := 0; i < len(fields); i += 2 {
-		key, ok := fields[i].(string)
-		if !ok {
-			return nil, fmt.Errorf("elements passed as keys must be strings but got %#v in position %d",
-				fields[i], i)
-		}
-		m[key] = fields[i+1]
-	}
-	return m, nil
-}
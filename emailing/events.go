@@ -0,0 +1,181 @@
+package emailing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of delivery event reported by the email provider
+type EventType string
+
+// the SendGrid event types we record
+const (
+	Processed  EventType = "processed"
+	Delivered  EventType = "delivered"
+	Bounce     EventType = "bounce"
+	Dropped    EventType = "dropped"
+	SpamReport EventType = "spamreport"
+	Open       EventType = "open"
+	Click      EventType = "click"
+)
+
+var recordedEventTypes = map[EventType]bool{
+	Processed:  true,
+	Delivered:  true,
+	Bounce:     true,
+	Dropped:    true,
+	SpamReport: true,
+	Open:       true,
+	Click:      true,
+}
+
+// Event records something that happened to a message we sent
+type Event struct {
+	// Our message ID as set by WithTracking
+	MessageID string `json:"message_id"`
+	// The dispatcher job that sent the message
+	JobID     string    `json:"job_id,omitempty"`
+	AccountID int       `json:"account_id,omitempty"`
+	Task      string    `json:"task,omitempty"`
+	Purpose   Purpose   `json:"purpose,omitempty"`
+	Email     string    `json:"email"`
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// Reason given for bounces and drops
+	Reason string `json:"reason,omitempty"`
+	// Either 'bounce' for hard bounces or 'blocked' for soft bounces
+	BounceType string `json:"bounce_type,omitempty"`
+	// URL followed for clicks
+	URL               string `json:"url,omitempty"`
+	ProviderEventID   string `json:"provider_event_id"`
+	ProviderMessageID string `json:"provider_message_id,omitempty"`
+}
+
+// EventStore records delivery events against the message they concern
+type EventStore interface {
+	// AddEvents records events, events already recorded (by their key) are ignored
+	AddEvents(events ...*Event) error
+	// FindEventsByMessageID returns events for a message in time order
+	FindEventsByMessageID(messageID string) ([]*Event, error)
+	// FindEventsByAccountID returns events for all messages concerning an account in time order
+	FindEventsByAccountID(accountID int) ([]*Event, error)
+}
+
+type sendgridEvent struct {
+	Email       string    `json:"email"`
+	Timestamp   int64     `json:"timestamp"`
+	Event       EventType `json:"event"`
+	SGEventID   string    `json:"sg_event_id"`
+	SGMessageID string    `json:"sg_message_id"`
+	Reason      string    `json:"reason"`
+	Type        string    `json:"type"`
+	URL         string    `json:"url"`
+	// Custom arguments are flattened into the event alongside the standard fields
+	MessageID string `json:"pericyte_message_id"`
+	JobID     string `json:"pericyte_job_id"`
+	AccountID string `json:"pericyte_account_id"`
+	Task      string `json:"pericyte_task"`
+	Purpose   string `json:"pericyte_purpose"`
+}
+
+// ParseSendgridEvents reads a SendGrid Event Webhook payload. Events for messages we did not tag with WithTracking
+// and event types we do not record are skipped.
+func ParseSendgridEvents(payload []byte) ([]*Event, error) {
+	var sgEvents []*sendgridEvent
+	err := json.Unmarshal(payload, &sgEvents)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse SendGrid events: %v", err)
+	}
+	events := make([]*Event, 0, len(sgEvents))
+	for _, sge := range sgEvents {
+		if sge.MessageID == "" || !recordedEventTypes[sge.Event] {
+			continue
+		}
+		accountID, _ := strconv.Atoi(sge.AccountID)
+		events = append(events, &Event{
+			MessageID:         sge.MessageID,
+			JobID:             sge.JobID,
+			AccountID:         accountID,
+			Task:              sge.Task,
+			Purpose:           Purpose(sge.Purpose),
+			Email:             sge.Email,
+			Type:              sge.Event,
+			Timestamp:         time.Unix(sge.Timestamp, 0).UTC(),
+			Reason:            sge.Reason,
+			BounceType:        sge.Type,
+			URL:               sge.URL,
+			ProviderEventID:   sge.SGEventID,
+			ProviderMessageID: sge.SGMessageID,
+		})
+	}
+	return events, nil
+}
+
+// key identifies an event so that repeated webhook deliveries of it are recorded once. The provider's event ID is used
+// where there is one, otherwise a hash of the event.
+func (e *Event) key() string {
+	if e.ProviderEventID != "" {
+		return e.ProviderEventID
+	}
+	bs, _ := json.Marshal(e)
+	sum := sha256.Sum256(bs)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+type memoryEventStore struct {
+	sync.RWMutex
+	seen      map[string]bool
+	byMessage map[string][]*Event
+	byAccount map[int][]*Event
+}
+
+// NewMemoryEventStore returns an EventStore that does not persist, useful for testing and development
+func NewMemoryEventStore() EventStore {
+	return &memoryEventStore{
+		seen:      make(map[string]bool),
+		byMessage: make(map[string][]*Event),
+		byAccount: make(map[int][]*Event),
+	}
+}
+
+func (s *memoryEventStore) AddEvents(events ...*Event) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, e := range events {
+		key := e.key()
+		if s.seen[key] {
+			continue
+		}
+		s.seen[key] = true
+		s.byMessage[e.MessageID] = append(s.byMessage[e.MessageID], e)
+		if e.AccountID != 0 {
+			s.byAccount[e.AccountID] = append(s.byAccount[e.AccountID], e)
+		}
+	}
+	return nil
+}
+
+func (s *memoryEventStore) FindEventsByMessageID(messageID string) ([]*Event, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return sortEvents(append([]*Event(nil), s.byMessage[messageID]...)), nil
+}
+
+func (s *memoryEventStore) FindEventsByAccountID(accountID int) ([]*Event, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return sortEvents(append([]*Event(nil), s.byAccount[accountID]...)), nil
+}
+
+func sortEvents(events []*Event) []*Event {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events
+}
@@ -0,0 +1,48 @@
+package emailing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSendgridEvents(t *testing.T) {
+	events, err := ParseSendgridEvents([]byte(`[
+		{"email": "cora@monax.io", "timestamp": 1600000000, "event": "bounce", "type": "bounce",
+			"sg_event_id": "event-1", "sg_message_id": "sg-1", "pericyte_message_id": "message-1",
+			"pericyte_job_id": "job-1", "pericyte_account_id": "4", "pericyte_task": "SignupEmail",
+			"pericyte_purpose": "Signup"},
+		{"email": "cora@monax.io", "timestamp": 1600000000, "event": "group_unsubscribe",
+			"pericyte_message_id": "message-1"},
+		{"email": "someone@else.com", "timestamp": 1600000000, "event": "delivered"}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	e := events[0]
+	assert.Equal(t, "message-1", e.MessageID)
+	assert.Equal(t, "job-1", e.JobID)
+	assert.Equal(t, 4, e.AccountID)
+	assert.Equal(t, "SignupEmail", e.Task)
+	assert.Equal(t, PurposeSignup, e.Purpose)
+	assert.Equal(t, Bounce, e.Type)
+	assert.Equal(t, "bounce", e.BounceType)
+	assert.Equal(t, int64(1600000000), e.Timestamp.Unix())
+}
+
+func TestMemoryEventStore(t *testing.T) {
+	store := NewMemoryEventStore()
+	delivered := &Event{MessageID: "message-1", AccountID: 4, Type: Delivered, ProviderEventID: "event-1"}
+	open := &Event{MessageID: "message-1", AccountID: 4, Type: Open}
+	click := &Event{MessageID: "message-1", AccountID: 4, Type: Click, URL: "https://monax.io"}
+	require.NoError(t, store.AddEvents(delivered, open, click))
+	// Webhook retries deliver the same events again, with or without provider event IDs
+	require.NoError(t, store.AddEvents(delivered, &Event{MessageID: "message-1", AccountID: 4, Type: Open}))
+
+	events, err := store.FindEventsByMessageID("message-1")
+	require.NoError(t, err)
+	assert.Len(t, events, 3, "events without a provider event ID do not collide")
+	events, err = store.FindEventsByAccountID(4)
+	require.NoError(t, err)
+	assert.Len(t, events, 3)
+}
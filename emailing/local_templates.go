@@ -0,0 +1,115 @@
+package emailing
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Files making up a local template, at least one of the bodies must exist
+const (
+	localSubjectFile = "subject.txt"
+	localTextFile    = "body.txt"
+	localHTMLFile    = "body.html"
+)
+
+// LocalTemplates renders templates held on disk for senders that deliver mail themselves rather than through a
+// provider with dynamic templates. Each template is a directory named by its template ID holding subject.txt and
+// body.txt and/or body.html, written as Go templates over the template parameters, e.g. {{.token_link}}.
+type LocalTemplates struct {
+	dir string
+}
+
+func NewLocalTemplates(dir string) *LocalTemplates {
+	return &LocalTemplates{dir: dir}
+}
+
+// Render sets the subject and content of email from its template and the template data of p. Emails without a
+// template are left as they are.
+func (t *LocalTemplates) Render(email *mail.SGMailV3, p *mail.Personalization) error {
+	if email.TemplateID == "" {
+		return nil
+	}
+	// Template IDs come from configuration but should still never escape the templates directory
+	if strings.ContainsAny(email.TemplateID, `/\`) || strings.HasPrefix(email.TemplateID, ".") {
+		return errors.New("invalid local template ID " + email.TemplateID)
+	}
+	dir := filepath.Join(t.dir, email.TemplateID)
+
+	subject, err := renderLocal(filepath.Join(dir, localSubjectFile), false, p.DynamicTemplateData)
+	if err != nil {
+		return err
+	}
+	p.Subject = strings.TrimSpace(subject)
+
+	email.Content = nil
+	for _, file := range []string{localTextFile, localHTMLFile} {
+		body, err := renderLocal(filepath.Join(dir, file), file == localHTMLFile, p.DynamicTemplateData)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		contentType := "text/plain"
+		if file == localHTMLFile {
+			contentType = "text/html"
+		}
+		// Plain text must come first, MIME alternatives are in increasing order of preference
+		email.AddContent(mail.NewContent(contentType, body))
+	}
+	if len(email.Content) == 0 {
+		return errors.New("local template " + email.TemplateID + " has no body")
+	}
+	return nil
+}
+
+// Preview is a Renderer for messages sent with local templates
+func (t *LocalTemplates) Preview(email *mail.SGMailV3) (*Preview, error) {
+	preview := &Preview{TemplateID: email.TemplateID}
+	for _, p := range email.Personalizations {
+		err := t.Render(email, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range email.Content {
+		switch c.Type {
+		case "text/plain":
+			preview.Text = c.Value
+		case "text/html":
+			preview.HTML = c.Value
+		}
+	}
+	return preview, nil
+}
+
+func renderLocal(path string, html bool, data map[string]interface{}) (string, error) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	// Escape parameters in HTML bodies since they include user input such as names
+	if html {
+		tmpl, err := htmltemplate.New(filepath.Base(path)).Option("missingkey=zero").Parse(string(source))
+		if err != nil {
+			return "", err
+		}
+		err = tmpl.Execute(buf, data)
+		return buf.String(), err
+	}
+	tmpl, err := texttemplate.New(filepath.Base(path)).Option("missingkey=zero").Parse(string(source))
+	if err != nil {
+		return "", err
+	}
+	err = tmpl.Execute(buf, data)
+	return buf.String(), err
+}
@@ -0,0 +1,235 @@
+package emailing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Transport delivers a message as raw MIME, for instance over SMTP
+type Transport func(from string, to []string, message []byte) error
+
+// NewMIMESender returns a Sender that renders messages with templates, builds each personalization as a MIME message,
+// signs it with signer (unless nil) and delivers it with transport
+func NewMIMESender(templates *LocalTemplates, signer *DKIMSigner, transport Transport) Sender {
+	return func(email *sgmail.SGMailV3) error {
+		for _, p := range email.Personalizations {
+			err := templates.Render(email, p)
+			if err != nil {
+				return err
+			}
+			message, err := BuildMIME(email, p, time.Now())
+			if err != nil {
+				return err
+			}
+			if signer != nil {
+				message, err = signer.Sign(domainOf(email.From.Address), message, time.Now())
+				if err != nil {
+					return err
+				}
+			}
+			var to []string
+			for _, recipients := range [][]*sgmail.Email{p.To, p.CC, p.BCC} {
+				for _, r := range recipients {
+					to = append(to, r.Address)
+				}
+			}
+			if sandboxed(email) {
+				continue
+			}
+			err = transport(email.From.Address, to, message)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// sandboxed returns true if email has sandbox mode set, see TemplateSettings
+func sandboxed(email *sgmail.SGMailV3) bool {
+	settings := email.MailSettings
+	return settings != nil && settings.SandboxMode != nil && settings.SandboxMode.Enable != nil &&
+		*settings.SandboxMode.Enable
+}
+
+// BuildMIME builds the RFC 5322 message for one personalization of email, which must have content rather than (or
+// rendered from) a template
+func BuildMIME(email *sgmail.SGMailV3, p *sgmail.Personalization, date time.Time) ([]byte, error) {
+	if email.From == nil {
+		return nil, fmt.Errorf("email has no From address")
+	}
+	subject := email.Subject
+	if p.Subject != "" {
+		subject = p.Subject
+	}
+	header := map[string]string{
+		"From":         formatAddress(email.From),
+		"Subject":      mime.QEncoding.Encode("utf-8", subject),
+		"Date":         date.Format(time.RFC1123Z),
+		"Message-ID":   fmt.Sprintf("<%s@%s>", messageID(email), domainOf(email.From.Address)),
+		"MIME-Version": "1.0",
+	}
+	if len(p.To) > 0 {
+		header["To"] = formatAddresses(p.To)
+	}
+	if len(p.CC) > 0 {
+		header["Cc"] = formatAddresses(p.CC)
+	}
+	if email.ReplyTo != nil {
+		header["Reply-To"] = formatAddress(email.ReplyTo)
+	}
+	for _, headers := range []map[string]string{email.Headers, p.Headers} {
+		for k, v := range headers {
+			header[textproto.CanonicalMIMEHeaderKey(k)] = v
+		}
+	}
+
+	body := new(bytes.Buffer)
+	contentType, encoding, err := writeBody(body, email)
+	if err != nil {
+		return nil, err
+	}
+	header["Content-Type"] = contentType
+	if encoding != "" {
+		header["Content-Transfer-Encoding"] = encoding
+	}
+
+	message := new(bytes.Buffer)
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(message, "%s: %s\r\n", k, header[k])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// writeBody writes the content and attachments of email as the body of a message returning its content type and
+// transfer encoding, empty for multipart bodies
+func writeBody(w io.Writer, email *sgmail.SGMailV3) (string, string, error) {
+	if len(email.Attachments) == 0 {
+		return writeContent(w, email.Content)
+	}
+	mixed := multipart.NewWriter(w)
+	content := new(bytes.Buffer)
+	contentType, encoding, err := writeContent(content, email.Content)
+	if err != nil {
+		return "", "", err
+	}
+	header := textproto.MIMEHeader{"Content-Type": {contentType}}
+	if encoding != "" {
+		header.Set("Content-Transfer-Encoding", encoding)
+	}
+	part, err := mixed.CreatePart(header)
+	if err != nil {
+		return "", "", err
+	}
+	_, err = part.Write(content.Bytes())
+	if err != nil {
+		return "", "", err
+	}
+	for _, a := range email.Attachments {
+		header := textproto.MIMEHeader{
+			"Content-Type":              {a.Type},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType(a.Disposition, map[string]string{"filename": a.Filename})},
+		}
+		if a.ContentID != "" {
+			header.Set("Content-ID", "<"+a.ContentID+">")
+		}
+		part, err = mixed.CreatePart(header)
+		if err != nil {
+			return "", "", err
+		}
+		// Attachment content is already base64 so only needs wrapping to the line length limit
+		for content := a.Content; len(content) > 0; {
+			n := len(content)
+			if n > 76 {
+				n = 76
+			}
+			_, err = io.WriteString(part, content[:n]+"\r\n")
+			if err != nil {
+				return "", "", err
+			}
+			content = content[n:]
+		}
+	}
+	return mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()}), "",
+		mixed.Close()
+}
+
+// writeContent writes a single content part directly or several as alternatives returning the content type and
+// transfer encoding, empty for alternatives whose parts each declare their own
+func writeContent(w io.Writer, contents []*sgmail.Content) (string, string, error) {
+	switch len(contents) {
+	case 0:
+		return "", "", fmt.Errorf("email has no content")
+	case 1:
+		// Headers of a single part are written by the caller, which must declare the encoding of the body
+		return contents[0].Type + "; charset=utf-8", "quoted-printable", writeQuotedPrintable(w, contents[0].Value)
+	}
+	alternative := multipart.NewWriter(w)
+	for _, c := range contents {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {c.Type + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", "", err
+		}
+		err = writeQuotedPrintable(part, c.Value)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.Boundary()}), "",
+		alternative.Close()
+}
+
+func writeQuotedPrintable(w io.Writer, value string) error {
+	qp := quotedprintable.NewWriter(w)
+	_, err := io.WriteString(qp, value)
+	if err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func formatAddress(e *sgmail.Email) string {
+	return (&mail.Address{Name: e.Name, Address: e.Address}).String()
+}
+
+func formatAddresses(es []*sgmail.Email) string {
+	addresses := make([]string, len(es))
+	for i, e := range es {
+		addresses[i] = formatAddress(e)
+	}
+	return strings.Join(addresses, ", ")
+}
+
+func domainOf(address string) string {
+	return strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+}
+
+// messageID uses our tracking ID when there is one so that the Message-ID header can be traced back to the job
+func messageID(email *sgmail.SGMailV3) string {
+	if id := email.CustomArgs[MessageIDArg]; id != "" {
+		return id
+	}
+	return NewTracking("", "", 0).MessageID
+}
@@ -0,0 +1,74 @@
+package emailing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMIMESinglePart(t *testing.T) {
+	// Long enough to be wrapped with soft line breaks and with '=' that quoted-printable escapes
+	link := "https://example.com/signup?token=abc&y=1&padding=" + strings.Repeat("x", 80)
+	message := func(attachments ...*sgmail.Attachment) *sgmail.SGMailV3 {
+		email := sgmail.NewV3Mail()
+		email.SetFrom(sgmail.NewEmail("", "noreply@example.com"))
+		email.AddContent(sgmail.NewContent("text/plain", "Complete your signup at "+link))
+		email.AddAttachment(attachments...)
+		p := sgmail.NewPersonalization()
+		p.AddTos(sgmail.NewEmail("", "user@example.net"))
+		email.AddPersonalizations(p)
+		return email
+	}
+	build := func(email *sgmail.SGMailV3) *mail.Message {
+		raw, err := BuildMIME(email, email.Personalizations[0], time.Now())
+		require.NoError(t, err)
+		parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+		require.NoError(t, err)
+		return parsed
+	}
+	decode := func(encoding string, body io.Reader) string {
+		require.Equal(t, "quoted-printable", encoding)
+		decoded, err := ioutil.ReadAll(quotedprintable.NewReader(body))
+		require.NoError(t, err)
+		return string(decoded)
+	}
+
+	t.Run("content only", func(t *testing.T) {
+		parsed := build(message())
+		assert.Equal(t, "text/plain; charset=utf-8", parsed.Header.Get("Content-Type"))
+		assert.Equal(t, "Complete your signup at "+link,
+			decode(parsed.Header.Get("Content-Transfer-Encoding"), parsed.Body))
+	})
+
+	t.Run("content and an attachment", func(t *testing.T) {
+		attachment := sgmail.NewAttachment()
+		attachment.SetFilename("terms.txt")
+		attachment.SetType("text/plain")
+		attachment.SetDisposition(DispositionAttachment)
+		attachment.SetContent(base64.StdEncoding.EncodeToString([]byte("terms")))
+		parsed := build(message(attachment))
+		assert.Empty(t, parsed.Header.Get("Content-Transfer-Encoding"))
+		mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		require.Equal(t, "multipart/mixed", mediaType)
+
+		// multipart.Reader decodes quoted-printable itself so read the raw part to check its header
+		part, err := multipart.NewReader(parsed.Body, params["boundary"]).NextRawPart()
+		require.NoError(t, err)
+		assert.Equal(t, "text/plain; charset=utf-8", part.Header.Get("Content-Type"))
+		assert.Equal(t, "Complete your signup at "+link,
+			decode(part.Header.Get("Content-Transfer-Encoding"), part))
+	})
+}
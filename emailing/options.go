@@ -0,0 +1,72 @@
+package emailing
+
+import (
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Custom arguments attached to every tracked message, SendGrid echoes these back on each webhook event
+const (
+	MessageIDArg = "pericyte_message_id"
+	JobIDArg     = "pericyte_job_id"
+	AccountIDArg = "pericyte_account_id"
+	TaskArg      = "pericyte_task"
+	PurposeArg   = "pericyte_purpose"
+)
+
+// Option modifies a message before it is passed to a Sender
+type Option func(m *mail.SGMailV3) error
+
+// Tracking identifies a message so that provider events about it can be linked back to its account and job
+type Tracking struct {
+	// Our ID for the message, generated when the message is formed
+	MessageID string
+	// The dispatcher job that sent the message, shared by every attempt the job makes at sending it
+	JobID string
+	// The account the message concerns, if any
+	AccountID int
+	// The dispatcher task that sent the message
+	Task string
+	// What the message is for
+	Purpose Purpose
+}
+
+// NewTracking generates a message ID for a message of purpose sent by task concerning the account with accountID,
+// which may be zero where no account exists
+func NewTracking(task string, purpose Purpose, accountID int) *Tracking {
+	return &Tracking{
+		MessageID: uuid.New().String(),
+		AccountID: accountID,
+		Task:      task,
+		Purpose:   purpose,
+	}
+}
+
+func WithTracking(tracking *Tracking) Option {
+	return func(m *mail.SGMailV3) error {
+		m.SetCustomArg(MessageIDArg, tracking.MessageID)
+		m.SetCustomArg(TaskArg, tracking.Task)
+		m.SetCustomArg(PurposeArg, string(tracking.Purpose))
+		if tracking.JobID != "" {
+			m.SetCustomArg(JobIDArg, tracking.JobID)
+		}
+		if tracking.AccountID != 0 {
+			m.SetCustomArg(AccountIDArg, strconv.Itoa(tracking.AccountID))
+		}
+		return nil
+	}
+}
+
+// MessageTracking recovers the Tracking attached to a message by WithTracking
+func MessageTracking(m *mail.SGMailV3) *Tracking {
+	accountID, _ := strconv.Atoi(m.CustomArgs[AccountIDArg])
+	return &Tracking{
+		MessageID: m.CustomArgs[MessageIDArg],
+		JobID:     m.CustomArgs[JobIDArg],
+		AccountID: accountID,
+		Task:      m.CustomArgs[TaskArg],
+		Purpose:   Purpose(m.CustomArgs[PurposeArg]),
+	}
+}
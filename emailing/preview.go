@@ -0,0 +1,41 @@
+package emailing
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Preview shows a message as it would be handed to the email provider
+type Preview struct {
+	TemplateID string `json:"template_id"`
+	// Payload is the request body for providers that render templates themselves
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// HTML and Text are the rendered bodies for templates rendered locally
+	HTML string `json:"html,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+// Renderer renders a message through a sender's rendering path without sending it
+type Renderer func(email *mail.SGMailV3) (*Preview, error)
+
+// NewRenderer returns the Renderer matching the Sender for t, smtp is only used for SMTP
+func NewRenderer(t SenderType, smtp *SMTPConfig) (Renderer, error) {
+	if t == SMTP {
+		if smtp == nil {
+			return nil, errors.New("previewing SMTP email needs SMTP configuration")
+		}
+		return NewLocalTemplates(smtp.TemplatesDir).Preview, nil
+	}
+	// The log sender stands in for SendGrid so preview what SendGrid would receive
+	return RenderSendgridPayload, nil
+}
+
+// RenderSendgridPayload previews the JSON body of the SendGrid mail send request for email
+func RenderSendgridPayload(email *mail.SGMailV3) (*Preview, error) {
+	return &Preview{
+		TemplateID: email.TemplateID,
+		Payload:    mail.GetRequestBody(email),
+	}, nil
+}
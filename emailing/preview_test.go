@@ -0,0 +1,85 @@
+package emailing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderSendgridPayload(t *testing.T) {
+	m, err := NewMessage("template-1", "cora@monax.io", mail.NewEmail("Monax", "noreply@monax.io"),
+		testParams{"token_link": "https://monax.io/signup?token=t"}, WithTracking(NewTracking("Preview", PurposeSignup, 0)))
+	require.NoError(t, err)
+
+	preview, err := RenderSendgridPayload(m)
+	require.NoError(t, err)
+	assert.Equal(t, "template-1", preview.TemplateID)
+
+	payload := new(struct {
+		TemplateID       string `json:"template_id"`
+		Personalizations []struct {
+			To                  []*mail.Email          `json:"to"`
+			DynamicTemplateData map[string]interface{} `json:"dynamic_template_data"`
+		} `json:"personalizations"`
+		CustomArgs map[string]string `json:"custom_args"`
+	})
+	require.NoError(t, json.Unmarshal(preview.Payload, payload))
+	assert.Equal(t, "template-1", payload.TemplateID)
+	require.Len(t, payload.Personalizations, 1)
+	assert.Equal(t, "cora@monax.io", payload.Personalizations[0].To[0].Address)
+	assert.Equal(t, "https://monax.io/signup?token=t", payload.Personalizations[0].DynamicTemplateData["token_link"])
+	assert.Equal(t, "Preview", payload.CustomArgs[TaskArg])
+}
+
+func TestNewRenderer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "signup"), 0700))
+	for file, content := range map[string]string{
+		localSubjectFile: "Welcome\n",
+		localTextFile:    "Complete your signup at {{.token_link}}",
+		localHTMLFile:    `<a href="{{.token_link}}">Complete your signup</a>`,
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "signup", file), []byte(content), 0600))
+	}
+	message := func() *mail.SGMailV3 {
+		m, err := NewMessage("signup", "cora@monax.io", mail.NewEmail("Monax", "noreply@monax.io"),
+			testParams{"token_link": "https://monax.io/signup?token=t"})
+		require.NoError(t, err)
+		return m
+	}
+
+	t.Run("SMTP renders local templates", func(t *testing.T) {
+		renderer, err := NewRenderer(SMTP, &SMTPConfig{TemplatesDir: dir})
+		require.NoError(t, err)
+		preview, err := renderer(message())
+		require.NoError(t, err)
+		assert.Equal(t, "signup", preview.TemplateID)
+		assert.Equal(t, "Complete your signup at https://monax.io/signup?token=t", preview.Text)
+		assert.Equal(t, `<a href="https://monax.io/signup?token=t">Complete your signup</a>`, preview.HTML)
+		assert.Empty(t, preview.Payload)
+
+		_, err = NewRenderer(SMTP, nil)
+		assert.Error(t, err, "SMTP needs configuration")
+	})
+
+	t.Run("SendGrid and log previews are the SendGrid payload", func(t *testing.T) {
+		for _, senderType := range []SenderType{SendGrid, Log} {
+			renderer, err := NewRenderer(senderType, nil)
+			require.NoError(t, err)
+			preview, err := renderer(message())
+			require.NoError(t, err)
+			assert.Equal(t, "signup", preview.TemplateID)
+			assert.NotEmpty(t, preview.Payload)
+			assert.Empty(t, preview.Text)
+			assert.Empty(t, preview.HTML)
+		}
+	})
+}
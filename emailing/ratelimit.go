@@ -0,0 +1,103 @@
+package emailing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"golang.org/x/time/rate"
+)
+
+// DefaultRetryAfter is the delay before retrying a rate limited message when the provider does not say how long to
+// wait
+const DefaultRetryAfter = time.Minute
+
+// MinRetryAfter is the shortest delay before retrying a rate limited message, so that a provider asking for no delay
+// is not retried in a tight loop
+const MinRetryAfter = time.Second
+
+// RateLimitError is returned by a Sender when a message cannot be sent until RetryAfter has passed
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("email rate limit reached, retry after %v", e.RetryAfter)
+}
+
+// Delay reports how long to wait before retrying, it is honoured by the workers in place of their usual backoff
+func (e *RateLimitError) Delay() time.Duration {
+	return e.RetryAfter
+}
+
+// RateLimitConfig keeps email sent under a provider quota. Limits apply to each process separately, so a quota shared
+// by several worker processes should be divided between them.
+type RateLimitConfig struct {
+	// Sustained number of messages per second from this process, zero or less for no limit
+	PerSecond float64
+	// Number of messages that can be sent at once after a quiet period
+	Burst int
+	// Longest a send will block waiting for capacity before being rescheduled with a RateLimitError instead
+	MaxWait time.Duration
+}
+
+// NewRateLimitedSender wraps sender so that messages are sent no faster than cfg allows. A single in-process limiter
+// is shared by everything sending through the returned Sender. Sends waiting for capacity when ctx is done are
+// rescheduled with a RateLimitError.
+func NewRateLimitedSender(ctx context.Context, sender Sender, cfg *RateLimitConfig) Sender {
+	if cfg.PerSecond <= 0 {
+		return sender
+	}
+	burst := cfg.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := rate.NewLimiter(rate.Limit(cfg.PerSecond), burst)
+	return func(email *mail.SGMailV3) error {
+		reservation := limiter.Reserve()
+		delay := reservation.Delay()
+		if delay > cfg.MaxWait {
+			// Give the capacity back so that it is available to whoever retries first
+			reservation.Cancel()
+			return &RateLimitError{RetryAfter: atLeastMin(delay)}
+		}
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return sender(email)
+		case <-ctx.Done():
+			reservation.Cancel()
+			return &RateLimitError{RetryAfter: atLeastMin(delay)}
+		}
+	}
+}
+
+// retryAfter reads how long the provider asked us to wait from a 429 response, understanding both forms of
+// Retry-After and SendGrid's X-RateLimit-Reset, and waiting at least MinRetryAfter
+func retryAfter(headers http.Header, now time.Time) time.Duration {
+	if value := headers.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return atLeastMin(time.Duration(seconds) * time.Second)
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return atLeastMin(at.Sub(now))
+		}
+	}
+	if value := headers.Get("X-RateLimit-Reset"); value != "" {
+		if reset, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return atLeastMin(time.Unix(reset, 0).Sub(now))
+		}
+	}
+	return DefaultRetryAfter
+}
+
+func atLeastMin(d time.Duration) time.Duration {
+	if d < MinRetryAfter {
+		return MinRetryAfter
+	}
+	return d
+}
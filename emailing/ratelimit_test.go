@@ -0,0 +1,85 @@
+package emailing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		headers  http.Header
+		expected time.Duration
+	}{
+		{http.Header{"Retry-After": {"30"}}, 30 * time.Second},
+		{http.Header{"Retry-After": {now.Add(time.Minute * 2).Format(http.TimeFormat)}}, 2 * time.Minute},
+		{http.Header{"X-Ratelimit-Reset": {"1591012845"}}, 45 * time.Second},
+		{http.Header{"X-Ratelimit-Reset": {"1591012000"}}, MinRetryAfter},
+		{http.Header{"Retry-After": {"0"}}, MinRetryAfter},
+		{http.Header{}, DefaultRetryAfter},
+	} {
+		assert.Equal(t, c.expected, retryAfter(c.headers, now), "%v", c.headers)
+	}
+}
+
+func TestRateLimitedSender(t *testing.T) {
+	sent := 0
+	sender := NewRateLimitedSender(context.Background(), func(email *mail.SGMailV3) error {
+		sent++
+		return nil
+	}, &RateLimitConfig{PerSecond: 1, Burst: 2, MaxWait: 10 * time.Millisecond})
+
+	require.NoError(t, sender(mail.NewV3Mail()))
+	require.NoError(t, sender(mail.NewV3Mail()))
+	err := sender(mail.NewV3Mail())
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.True(t, rateLimitErr.Delay() > 900*time.Millisecond)
+	assert.Equal(t, 2, sent)
+}
+
+func TestRateLimitedSenderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sent := 0
+	sender := NewRateLimitedSender(ctx, func(email *mail.SGMailV3) error {
+		sent++
+		return nil
+	}, &RateLimitConfig{PerSecond: 1, MaxWait: time.Hour})
+
+	require.NoError(t, sender(mail.NewV3Mail()))
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	err := sender(mail.NewV3Mail())
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "stops waiting once cancelled")
+	assert.Equal(t, 1, sent)
+}
+
+func TestRateLimitedSenderBounds(t *testing.T) {
+	sent := 0
+	send := func(email *mail.SGMailV3) error {
+		sent++
+		return nil
+	}
+
+	unlimited := NewRateLimitedSender(context.Background(), send, &RateLimitConfig{})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, unlimited(mail.NewV3Mail()), "no rate is no limit")
+	}
+	assert.Equal(t, 10, sent)
+
+	sender := NewRateLimitedSender(context.Background(), send, &RateLimitConfig{PerSecond: 100})
+	require.NoError(t, sender(mail.NewV3Mail()))
+	err := sender(mail.NewV3Mail())
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.Equal(t, MinRetryAfter, rateLimitErr.Delay(), "short waits are retried no sooner than MinRetryAfter")
+}
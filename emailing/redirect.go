@@ -0,0 +1,112 @@
+package emailing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/sirupsen/logrus"
+)
+
+// Where a redirected message records the recipient it was originally addressed to
+const (
+	OriginalRecipientHeader = "X-Pericyte-Original-Recipient"
+	OriginalRecipientParam  = "original_recipient"
+)
+
+// RedirectConfig restricts who receives email, intended for staging environments that use real provider
+// credentials
+type RedirectConfig struct {
+	// Addresses that receive email as normal
+	AllowedAddresses []string
+	// Domains whose addresses receive email as normal, e.g. 'monax.io'
+	AllowedDomains []string
+	// All other recipients are replaced with this address
+	CatchAll string
+}
+
+var redirectedRecipients = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "pericyte",
+	Subsystem: "email",
+	Name:      "redirected_recipients_total",
+	Help:      "Recipients not on the allowlist whose email was redirected to the catch-all address",
+}, []string{"template_id"})
+
+// NewRedirectingSender wraps sender so that recipients not allowed by cfg are replaced with the catch-all address.
+// The catch-all address is required.
+func NewRedirectingSender(sender Sender, cfg *RedirectConfig, logger logrus.FieldLogger) (Sender, error) {
+	if strings.TrimSpace(cfg.CatchAll) == "" {
+		return nil, fmt.Errorf("email redirection needs a catch-all address")
+	}
+	logger = logger.WithField("scope", "RedirectingSender")
+	addresses := make(map[string]bool, len(cfg.AllowedAddresses))
+	for _, a := range cfg.AllowedAddresses {
+		addresses[strings.ToLower(a)] = true
+	}
+	domains := make(map[string]bool, len(cfg.AllowedDomains))
+	for _, d := range cfg.AllowedDomains {
+		domains[strings.ToLower(d)] = true
+	}
+	allowed := func(address string) bool {
+		address = strings.ToLower(address)
+		return addresses[address] || domains[address[strings.LastIndex(address, "@")+1:]]
+	}
+
+	return func(email *mail.SGMailV3) error {
+		for _, p := range email.Personalizations {
+			var originals []string
+			for _, recipients := range [][]*mail.Email{p.To, p.CC, p.BCC} {
+				for _, r := range recipients {
+					if allowed(r.Address) {
+						continue
+					}
+					originals = append(originals, r.Address)
+					logger.WithFields(logrus.Fields{
+						"to":          r.Address,
+						"redirect_to": cfg.CatchAll,
+						"template_id": email.TemplateID,
+					}).Warn("redirecting email for recipient not on allowlist")
+					redirectedRecipients.WithLabelValues(email.TemplateID).Inc()
+					r.Address = cfg.CatchAll
+				}
+			}
+			if len(originals) > 0 {
+				// Several redirected recipients become one catch-all recipient since providers reject a message that
+				// lists an address more than once
+				dedupRecipients(p)
+				original := strings.Join(originals, ", ")
+				if p.Headers == nil {
+					p.Headers = make(map[string]string)
+				}
+				p.Headers[OriginalRecipientHeader] = original
+				if p.DynamicTemplateData == nil {
+					p.DynamicTemplateData = make(map[string]interface{})
+				}
+				p.DynamicTemplateData[OriginalRecipientParam] = original
+			}
+		}
+		return sender(email)
+	}, nil
+}
+
+// dedupRecipients drops repeats of an address across the To, CC and BCC recipients of p, keeping the first
+func dedupRecipients(p *mail.Personalization) {
+	seen := make(map[string]bool)
+	dedup := func(recipients []*mail.Email) []*mail.Email {
+		var kept []*mail.Email
+		for _, r := range recipients {
+			address := strings.ToLower(r.Address)
+			if seen[address] {
+				continue
+			}
+			seen[address] = true
+			kept = append(kept, r)
+		}
+		return kept
+	}
+	p.To = dedup(p.To)
+	p.CC = dedup(p.CC)
+	p.BCC = dedup(p.BCC)
+}
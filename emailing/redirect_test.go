@@ -0,0 +1,59 @@
+package emailing
+
+import (
+	"testing"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectingSender(t *testing.T) {
+	var sent *mail.SGMailV3
+	sender, err := NewRedirectingSender(func(email *mail.SGMailV3) error {
+		sent = email
+		return nil
+	}, &RedirectConfig{
+		AllowedAddresses: []string{"qa@example.com"},
+		AllowedDomains:   []string{"monax.io"},
+		CatchAll:         "catchall@monax.io",
+	}, logrus.New())
+	require.NoError(t, err)
+
+	t.Run("allowed recipients are untouched", func(t *testing.T) {
+		for _, to := range []string{"QA@example.com", "silas@monax.io"} {
+			err := Send(sender, "template", to, mail.NewEmail("", "from@monax.io"), testParams{})
+			require.NoError(t, err)
+			assert.Equal(t, []string{to}, ToAddresses(sent))
+			assert.NotContains(t, TemplateData(sent), OriginalRecipientParam)
+		}
+	})
+
+	t.Run("other recipients are redirected", func(t *testing.T) {
+		err := Send(sender, "template", "customer@example.com", mail.NewEmail("", "from@monax.io"), testParams{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"catchall@monax.io"}, ToAddresses(sent))
+		assert.Equal(t, "customer@example.com", TemplateData(sent)[OriginalRecipientParam])
+		assert.Equal(t, "customer@example.com", sent.Personalizations[0].Headers[OriginalRecipientHeader])
+	})
+
+	t.Run("redirected recipients are not repeated", func(t *testing.T) {
+		email, err := NewMessage("template", "customer@example.com", mail.NewEmail("", "from@monax.io"), testParams{})
+		require.NoError(t, err)
+		email.Personalizations[0].AddTos(mail.NewEmail("", "other@example.com"), mail.NewEmail("", "qa@example.com"))
+		email.Personalizations[0].AddCCs(mail.NewEmail("", "cc@example.com"))
+		require.NoError(t, sender(email))
+		p := sent.Personalizations[0]
+		assert.Equal(t, []string{"catchall@monax.io", "qa@example.com"}, ToAddresses(sent))
+		assert.Empty(t, p.CC)
+		assert.Equal(t, "customer@example.com, other@example.com, cc@example.com", p.Headers[OriginalRecipientHeader])
+	})
+}
+
+func TestRedirectingSenderNeedsCatchAll(t *testing.T) {
+	_, err := NewRedirectingSender(func(email *mail.SGMailV3) error {
+		return nil
+	}, &RedirectConfig{AllowedDomains: []string{"monax.io"}}, logrus.New())
+	assert.Error(t, err)
+}
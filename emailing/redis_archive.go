@@ -0,0 +1,137 @@
+package emailing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultArchiveRetention is used when no retention period is configured
+const DefaultArchiveRetention = 30 * 24 * time.Hour
+
+// Fields of the hash holding an archived message
+const (
+	archiveMessageField           = "message"
+	archiveProviderMessageIDField = "provider_message_id"
+)
+
+// setIfExistsScript sets a field of a hash only if the hash exists, so that a message that has expired or was never
+// archived is not recreated as a hash with no message
+var setIfExistsScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+end
+return 0
+`)
+
+type redisArchiveStore struct {
+	client *redis.Client
+	// How long messages are kept after they were sent
+	retention time.Duration
+}
+
+// NewRedisArchiveStore returns an ArchiveStore keeping messages in redis for the retention period
+func NewRedisArchiveStore(client *redis.Client, retention time.Duration) ArchiveStore {
+	if retention <= 0 {
+		retention = DefaultArchiveRetention
+	}
+	return &redisArchiveStore{
+		client:    client,
+		retention: retention,
+	}
+}
+
+func (s *redisArchiveStore) Archive(message *ArchivedMessage) error {
+	bs, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	member := redis.Z{
+		Score:  float64(message.Timestamp.Unix()),
+		Member: message.MessageID,
+	}
+	// Index entries outlive the messages they point to if they are only expired as a whole, so also trim them
+	expired := strconv.FormatInt(message.Timestamp.Add(-s.retention).Unix(), 10)
+	_, err = s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(archivedMessageKey(message.MessageID), archiveMessageField, bs)
+		pipe.Expire(archivedMessageKey(message.MessageID), s.retention)
+		var indexes []string
+		if message.AccountID != 0 {
+			indexes = append(indexes, accountArchiveKey(message.AccountID))
+		}
+		for _, hash := range message.RecipientHashes {
+			indexes = append(indexes, recipientArchiveKey(hash))
+		}
+		for _, index := range indexes {
+			pipe.ZAdd(index, member)
+			pipe.ZRemRangeByScore(index, "-inf", "("+expired)
+			pipe.Expire(index, s.retention)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *redisArchiveStore) SetProviderMessageID(messageID, providerMessageID string) error {
+	return setIfExistsScript.Run(s.client, []string{archivedMessageKey(messageID)}, archiveProviderMessageIDField,
+		providerMessageID).Err()
+}
+
+func (s *redisArchiveStore) FindArchivedByAccountID(accountID int) ([]*ArchivedMessage, error) {
+	return s.find(accountArchiveKey(accountID))
+}
+
+func (s *redisArchiveStore) FindArchivedByRecipient(address string) ([]*ArchivedMessage, error) {
+	return s.find(recipientArchiveKey(RecipientHash(address)))
+}
+
+func (s *redisArchiveStore) find(index string) ([]*ArchivedMessage, error) {
+	messageIDs, err := s.client.ZRange(index, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.SliceCmd, len(messageIDs))
+	_, err = s.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, messageID := range messageIDs {
+			cmds[i] = pipe.HMGet(archivedMessageKey(messageID), archiveMessageField, archiveProviderMessageIDField)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*ArchivedMessage, 0, len(cmds))
+	for _, cmd := range cmds {
+		values := cmd.Val()
+		value, ok := values[0].(string)
+		if !ok {
+			// Expired
+			continue
+		}
+		message := new(ArchivedMessage)
+		err = json.Unmarshal([]byte(value), message)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode archived email: %v", err)
+		}
+		if providerMessageID, ok := values[1].(string); ok {
+			message.ProviderMessageID = providerMessageID
+		}
+		messages = append(messages, message)
+	}
+	return sortArchivedMessages(messages), nil
+}
+
+func archivedMessageKey(messageID string) string {
+	return "pericyte:email:archive:" + messageID
+}
+
+func accountArchiveKey(accountID int) string {
+	return fmt.Sprintf("pericyte:email:archive-account:%d", accountID)
+}
+
+func recipientArchiveKey(hash string) string {
+	return "pericyte:email:archive-recipient:" + hash
+}
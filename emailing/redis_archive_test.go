@@ -0,0 +1,53 @@
+// +build integration
+
+package emailing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redisTestURL = "redis://localhost:6379/0"
+
+func TestRedisArchiveStore(t *testing.T) {
+	client := redisClient(t)
+	store := NewRedisArchiveStore(client, time.Hour)
+
+	message := &ArchivedMessage{
+		MessageID:       "message-1",
+		JobID:           "job-1",
+		Timestamp:       time.Now(),
+		AccountID:       4,
+		RecipientHashes: []string{RecipientHash("cora@monax.io")},
+		Outcome:         OutcomeSent,
+	}
+	require.NoError(t, store.Archive(message))
+	require.NoError(t, store.SetProviderMessageID("message-1", "sg-1"))
+	// Messages we did not archive are not created
+	require.NoError(t, store.SetProviderMessageID("message-2", "sg-2"))
+	exists, err := client.Exists(archivedMessageKey("message-2")).Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists)
+
+	messages, err := store.FindArchivedByRecipient("Cora@monax.io")
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "job-1", messages[0].JobID)
+	assert.Equal(t, "sg-1", messages[0].ProviderMessageID)
+
+	messages, err = store.FindArchivedByAccountID(4)
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+}
+
+func redisClient(t *testing.T) *redis.Client {
+	opts, err := redis.ParseURL(redisTestURL)
+	require.NoError(t, err)
+	cli := redis.NewClient(opts)
+	require.NoError(t, cli.FlushAll().Err())
+	return cli
+}
@@ -0,0 +1,102 @@
+package emailing
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultEventRetention is used when no retention period is configured
+const DefaultEventRetention = 90 * 24 * time.Hour
+
+type redisEventStore struct {
+	client *redis.Client
+	// How long events are kept after the last event for a message or account
+	ttl time.Duration
+}
+
+// NewRedisEventStore returns an EventStore keeping events in redis for ttl after the latest event
+func NewRedisEventStore(client *redis.Client, ttl time.Duration) EventStore {
+	if ttl <= 0 {
+		ttl = DefaultEventRetention
+	}
+	return &redisEventStore{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (s *redisEventStore) AddEvents(events ...*Event) error {
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		for _, e := range events {
+			bs, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			// Keyed by event so webhook retries are idempotent
+			pipe.HSetNX(messageEventsKey(e.MessageID), e.key(), bs)
+			pipe.Expire(messageEventsKey(e.MessageID), s.ttl)
+			if e.AccountID != 0 {
+				pipe.ZAdd(accountMessagesKey(e.AccountID), redis.Z{
+					Score:  float64(e.Timestamp.Unix()),
+					Member: e.MessageID,
+				})
+				pipe.Expire(accountMessagesKey(e.AccountID), s.ttl)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *redisEventStore) FindEventsByMessageID(messageID string) ([]*Event, error) {
+	values, err := s.client.HVals(messageEventsKey(messageID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeEvents(values)
+}
+
+func (s *redisEventStore) FindEventsByAccountID(accountID int) ([]*Event, error) {
+	messageIDs, err := s.client.ZRange(accountMessagesKey(accountID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.StringSliceCmd, len(messageIDs))
+	_, err = s.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, messageID := range messageIDs {
+			cmds[i] = pipe.HVals(messageEventsKey(messageID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, cmd := range cmds {
+		values = append(values, cmd.Val()...)
+	}
+	return decodeEvents(values)
+}
+
+func decodeEvents(values []string) ([]*Event, error) {
+	events := make([]*Event, len(values))
+	for i, v := range values {
+		events[i] = new(Event)
+		err := json.Unmarshal([]byte(v), events[i])
+		if err != nil {
+			return nil, fmt.Errorf("could not decode stored email event: %v", err)
+		}
+	}
+	return sortEvents(events), nil
+}
+
+func messageEventsKey(messageID string) string {
+	return "pericyte:email:events:" + messageID
+}
+
+func accountMessagesKey(accountID int) string {
+	return fmt.Sprintf("pericyte:email:account-messages:%d", accountID)
+}
@@ -0,0 +1,51 @@
+package emailing
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis"
+)
+
+const suppressionsKey = "pericyte:email:suppressions"
+
+type redisSuppressionStore struct {
+	client *redis.Client
+}
+
+// NewRedisSuppressionStore returns a SuppressionStore keeping suppressions in a redis hash
+func NewRedisSuppressionStore(client *redis.Client) SuppressionStore {
+	return &redisSuppressionStore{client: client}
+}
+
+func (s *redisSuppressionStore) Suppress(suppression *Suppression) error {
+	bs, err := json.Marshal(suppression)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(suppressionsKey, suppressionKey(suppression.Email), bs).Err()
+}
+
+func (s *redisSuppressionStore) Unsuppress(email string) (bool, error) {
+	n, err := s.client.HDel(suppressionsKey, suppressionKey(email)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *redisSuppressionStore) FindSuppression(email string) (*Suppression, error) {
+	value, err := s.client.HGet(suppressionsKey, suppressionKey(email)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	suppression := new(Suppression)
+	err = json.Unmarshal([]byte(value), suppression)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode stored suppression: %v", err)
+	}
+	return suppression, nil
+}
@@ -0,0 +1,88 @@
+package emailing
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sendgrid/rest"
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+const (
+	DefaultSendgridURL     = "https://api.sendgrid.com"
+	DefaultSendgridTimeout = 30 * time.Second
+	// IdempotencyKeyHeader carries the tracking job ID, or message ID outside of a job, so that a request retried after
+	// a timeout can be recognised as the same message by SendGrid or a proxy in front of it
+	IdempotencyKeyHeader = "Idempotency-Key"
+)
+
+// SendgridConfig configures how the SendGrid API is reached, the zero value uses SendGrid's global endpoint
+type SendgridConfig struct {
+	// Base URL of the API, e.g. https://api.eu.sendgrid.com for EU data residency or a local stand-in
+	BaseURL string
+	// Timeout for each request including reading the response, defaults to DefaultSendgridTimeout
+	Timeout time.Duration
+	// Proxy URL, defaults to the HTTPS_PROXY and NO_PROXY environment variables
+	ProxyURL            string
+	MaxIdleConnsPerHost int
+	// HTTPClient replaces the client built from the settings above so can only be set in code
+	HTTPClient *http.Client `json:"-"`
+}
+
+// sendgridClient is the SendGrid API at a base URL
+type sendgridClient struct {
+	credentials string
+	baseURL     string
+	client      *rest.Client
+}
+
+func newSendgridClient(credentials string, cfg *SendgridConfig) (*sendgridClient, error) {
+	if cfg == nil {
+		cfg = new(SendgridConfig)
+	}
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = DefaultSendgridURL
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if cfg.ProxyURL != "" {
+			proxy, err := url.Parse(cfg.ProxyURL)
+			if err != nil {
+				return nil, err
+			}
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+		if cfg.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		}
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultSendgridTimeout
+		}
+		httpClient = &http.Client{Transport: transport, Timeout: timeout}
+	}
+	return &sendgridClient{
+		credentials: credentials,
+		baseURL:     baseURL,
+		client:      &rest.Client{HTTPClient: httpClient},
+	}, nil
+}
+
+func (c *sendgridClient) request(method rest.Method, endpoint string) rest.Request {
+	req := sendgrid.GetRequest(c.credentials, endpoint, c.baseURL)
+	req.Method = method
+	return req
+}
+
+// idempotencyKey is shared by every attempt a job makes at sending a message
+func idempotencyKey(email *mail.SGMailV3) string {
+	if id := email.CustomArgs[JobIDArg]; id != "" {
+		return id
+	}
+	return email.CustomArgs[MessageIDArg]
+}
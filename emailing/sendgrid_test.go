@@ -0,0 +1,102 @@
+package emailing
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendgridSender(t *testing.T) {
+	var status int
+	var requests []*http.Request
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make(map[string]interface{})
+		payload, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(payload, &body)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "7")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sender, err := NewSendgridSender("key", &SendgridConfig{BaseURL: server.URL + "/"})
+	require.NoError(t, err)
+	tracking := NewTracking("signup", PurposeSignup, 0)
+	tracking.JobID = "job-1"
+	email, err := NewMessage("template", "user@example.com", mail.NewEmail("", "noreply@example.com"),
+		testParams{"token": "abc"}, WithTracking(tracking))
+	require.NoError(t, err)
+	retry := NewTracking("signup", PurposeSignup, 0)
+	retry.JobID = tracking.JobID
+	retried, err := NewMessage("template", "user@example.com", mail.NewEmail("", "noreply@example.com"),
+		testParams{"token": "abc"}, WithTracking(retry))
+	require.NoError(t, err)
+
+	status = http.StatusAccepted
+	require.NoError(t, sender(email))
+	require.NoError(t, sender(retried))
+	require.Len(t, requests, 2)
+	r := requests[0]
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.Equal(t, "/v3/mail/send", r.URL.Path)
+	assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+	assert.Equal(t, tracking.JobID, r.Header.Get(IdempotencyKeyHeader))
+	assert.Equal(t, r.Header.Get(IdempotencyKeyHeader), requests[1].Header.Get(IdempotencyKeyHeader),
+		"retries have the same idempotency key")
+	assert.Equal(t, "template", bodies[0]["template_id"])
+
+	status = http.StatusTooManyRequests
+	err = sender(email)
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.Equal(t, 7*time.Second, rateLimitErr.Delay())
+
+	status = http.StatusInternalServerError
+	assert.Error(t, sender(email))
+}
+
+func TestSendgridSenderTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	sender, err := NewSendgridSender("key", &SendgridConfig{BaseURL: server.URL, Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	email, err := NewMessage("template", "user@example.com", mail.NewEmail("", "noreply@example.com"),
+		testParams{})
+	require.NoError(t, err)
+	assert.Error(t, sender(email))
+}
+
+func TestSendgridTemplateInspector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/v3/templates/template", r.URL.Path)
+		_, _ = w.Write([]byte(`{"versions": [
+			{"active": 0, "subject": "{{old}}"},
+			{"active": 1, "subject": "Hi {{name}}", "html_content": "{{{token_link}}}"}
+		]}`))
+	}))
+	defer server.Close()
+
+	inspector, err := NewSendgridTemplateInspector("key", &SendgridConfig{BaseURL: server.URL})
+	require.NoError(t, err)
+	variables, err := inspector.TemplateVariables("template")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "token_link"}, variables)
+}
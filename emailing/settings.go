@@ -0,0 +1,63 @@
+package emailing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Custom arguments with this prefix are reserved for tracking, see WithTracking
+const reservedArgPrefix = "pericyte_"
+
+// TemplateSettings configures provider features for messages of a particular purpose
+type TemplateSettings struct {
+	// Categories tag messages for provider analytics
+	Categories []string
+	// CustomArgs are attached to messages and echoed back on webhook events, keys must not start with 'pericyte_'
+	CustomArgs map[string]string
+	// UnsubscribeGroupID is the ASM unsubscribe group for non-transactional mail, zero for none
+	UnsubscribeGroupID int
+	// UnsubscribeGroupsToDisplay lists the groups shown on the unsubscribe preferences page
+	UnsubscribeGroupsToDisplay []int
+	// IPPool names a dedicated IP pool to send from
+	IPPool string
+	// Sandbox has the provider validate messages without delivering them, for load tests. The SMTP sender renders and
+	// signs sandboxed messages but does not deliver them.
+	Sandbox bool
+}
+
+// WithSettings applies settings to a message, nil settings leave the message unchanged. Custom args that would
+// overwrite tracking are rejected.
+func WithSettings(settings *TemplateSettings) Option {
+	return func(m *mail.SGMailV3) error {
+		if settings == nil {
+			return nil
+		}
+		for k := range settings.CustomArgs {
+			if strings.HasPrefix(k, reservedArgPrefix) {
+				return fmt.Errorf("custom arg %s is reserved for tracking", k)
+			}
+		}
+		m.AddCategories(settings.Categories...)
+		for k, v := range settings.CustomArgs {
+			m.SetCustomArg(k, v)
+		}
+		if settings.UnsubscribeGroupID != 0 {
+			asm := mail.NewASM()
+			asm.SetGroupID(settings.UnsubscribeGroupID)
+			asm.AddGroupsToDisplay(settings.UnsubscribeGroupsToDisplay...)
+			m.SetASM(asm)
+		}
+		if settings.IPPool != "" {
+			m.SetIPPoolID(settings.IPPool)
+		}
+		if settings.Sandbox {
+			if m.MailSettings == nil {
+				m.SetMailSettings(mail.NewMailSettings())
+			}
+			m.MailSettings.SetSandboxMode(mail.NewSetting(true))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,52 @@
+package emailing
+
+import (
+	"testing"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSettings(t *testing.T) {
+	from := mail.NewEmail("", "noreply@monax.io")
+
+	t.Run("nil settings leave the message unchanged", func(t *testing.T) {
+		m, err := NewMessage("template", "cora@monax.io", from, testParams{}, WithSettings(nil))
+		require.NoError(t, err)
+		assert.Empty(t, m.Categories)
+		assert.Empty(t, m.CustomArgs)
+		assert.Nil(t, m.Asm)
+		assert.Nil(t, m.MailSettings)
+	})
+
+	t.Run("settings are applied", func(t *testing.T) {
+		m, err := NewMessage("template", "cora@monax.io", from, testParams{}, WithSettings(&TemplateSettings{
+			Categories:                 []string{"signup", "onboarding"},
+			CustomArgs:                 map[string]string{"campaign": "autumn"},
+			UnsubscribeGroupID:         42,
+			UnsubscribeGroupsToDisplay: []int{42, 43},
+			IPPool:                     "transactional",
+			Sandbox:                    true,
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"signup", "onboarding"}, m.Categories)
+		assert.Equal(t, "autumn", m.CustomArgs["campaign"])
+		require.NotNil(t, m.Asm)
+		assert.Equal(t, 42, m.Asm.GroupID)
+		assert.Equal(t, []int{42, 43}, m.Asm.GroupsToDisplay)
+		assert.Equal(t, "transactional", m.IPPoolID)
+		require.NotNil(t, m.MailSettings)
+		assert.True(t, *m.MailSettings.SandboxMode.Enable)
+	})
+
+	t.Run("tracking args are reserved", func(t *testing.T) {
+		tracking := NewTracking("Test", PurposeSignup, 4)
+		_, err := NewMessage("template", "cora@monax.io", from, testParams{}, WithTracking(tracking),
+			WithSettings(&TemplateSettings{CustomArgs: map[string]string{MessageIDArg: "forged"}}))
+		assert.Error(t, err)
+		_, err = NewMessage("template", "cora@monax.io", from, testParams{},
+			WithSettings(&TemplateSettings{CustomArgs: map[string]string{"pericyte_other": "x"}}))
+		assert.Error(t, err)
+	})
+}
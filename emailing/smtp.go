@@ -0,0 +1,119 @@
+package emailing
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// DefaultSMTPTimeout bounds delivering a message over SMTP when no timeout is configured
+const DefaultSMTPTimeout = 30 * time.Second
+
+// SMTPConfig configures delivering mail directly over SMTP with local templates
+type SMTPConfig struct {
+	// host:port of the submission server, which must support STARTTLS when credentials are given
+	Address  string
+	Username string
+	Password string
+	// Directory holding the local templates named by the configured template IDs, see LocalTemplates
+	TemplatesDir string
+	// Sign messages when set, see DKIMSigner
+	DKIM *DKIMConfig
+	// Timeout for connecting and delivering each message, defaults to DefaultSMTPTimeout
+	Timeout time.Duration
+}
+
+// NewSMTPSender returns a Sender rendering local templates and delivering them, DKIM signed if configured, over SMTP.
+// Messages with sandbox mode set are rendered and signed but not delivered.
+func NewSMTPSender(cfg *SMTPConfig) (Sender, error) {
+	if cfg == nil {
+		return nil, errors.New("the SMTP sender needs SMTP configuration")
+	}
+	var signer *DKIMSigner
+	if cfg.DKIM != nil {
+		var err error
+		signer, err = NewDKIMSigner(cfg.DKIM)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		host, _, err := net.SplitHostPort(cfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSMTPTimeout
+	}
+	return NewMIMESender(NewLocalTemplates(cfg.TemplatesDir), signer,
+		func(from string, to []string, message []byte) error {
+			return sendMail(cfg.Address, auth, timeout, from, to, message)
+		}), nil
+}
+
+// sendMail is smtp.SendMail with the whole exchange, including connecting, bounded by timeout
+func sendMail(address string, auth smtp.Auth, timeout time.Duration, from string, to []string, message []byte) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	conn, err := (&net.Dialer{Timeout: timeout}).Dial("tcp", address)
+	if err != nil {
+		return err
+	}
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		err = client.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, addr := range to {
+		err = client.Rcpt(addr)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(message)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
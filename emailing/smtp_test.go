@@ -0,0 +1,62 @@
+package emailing
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSMTPSender(t *testing.T) {
+	_, err := NewSMTPSender(nil)
+	assert.Error(t, err, "SMTP needs configuration")
+
+	_, err = NewSender(SMTP, "", nil, nil, logrus.New())
+	assert.Error(t, err, "SMTP sender is not silently replaced")
+
+	sender, err := NewSender(SMTP, "", nil, &SMTPConfig{Address: "localhost:25"}, logrus.New())
+	require.NoError(t, err)
+	assert.NotNil(t, sender)
+}
+
+func TestMIMESenderSandbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "signup"), 0700))
+	for file, content := range map[string]string{
+		localSubjectFile: "Welcome\n",
+		localTextFile:    "Complete your signup at {{.token_link}}",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "signup", file), []byte(content), 0600))
+	}
+
+	var delivered [][]string
+	sender := NewMIMESender(NewLocalTemplates(dir), nil, func(from string, to []string, message []byte) error {
+		delivered = append(delivered, to)
+		return nil
+	})
+	send := func(settings *TemplateSettings) error {
+		m, err := NewMessage("signup", "cora@monax.io", mail.NewEmail("Monax", "noreply@monax.io"),
+			testParams{"token_link": "https://monax.io/signup?token=t"}, WithSettings(settings))
+		require.NoError(t, err)
+		return sender(m)
+	}
+
+	require.NoError(t, send(&TemplateSettings{Sandbox: true}))
+	assert.Empty(t, delivered, "sandboxed messages are not delivered")
+
+	require.NoError(t, send(nil))
+	assert.Equal(t, [][]string{{"cora@monax.io"}}, delivered)
+
+	sender = NewMIMESender(NewLocalTemplates(dir), nil, func(string, []string, []byte) error {
+		return errors.New("transport down")
+	})
+	assert.Error(t, send(nil))
+}
@@ -0,0 +1,140 @@
+package emailing
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/sirupsen/logrus"
+)
+
+// SuppressionReason records why we stopped sending to an address
+type SuppressionReason string
+
+// all known suppression reasons
+const (
+	SuppressedBounce     SuppressionReason = "bounce"
+	SuppressedSpamReport SuppressionReason = "spamreport"
+	SuppressedManual     SuppressionReason = "manual"
+)
+
+// Suppression marks an address we must not send to
+type Suppression struct {
+	Email  string            `json:"email"`
+	Reason SuppressionReason `json:"reason"`
+	// Provider bounce reason or a note from the admin that added the suppression
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SuppressionStore holds suppressed addresses, addresses are compared case-insensitively
+type SuppressionStore interface {
+	Suppress(suppression *Suppression) error
+	// Unsuppress returns false if the address was not suppressed
+	Unsuppress(email string) (bool, error)
+	// FindSuppression returns nil if the address is not suppressed
+	FindSuppression(email string) (*Suppression, error)
+}
+
+// SuppressedError is returned by a Sender wrapped with NewSuppressingSender for suppressed recipients
+type SuppressedError struct {
+	Suppression *Suppression
+}
+
+func (e *SuppressedError) Error() string {
+	return fmt.Sprintf("not sending to %s since it is suppressed due to %s", e.Suppression.Email,
+		e.Suppression.Reason)
+}
+
+// Permanent marks this as a failure that retrying will not resolve
+func (e *SuppressedError) Permanent() bool {
+	return true
+}
+
+// NewSuppressingSender wraps sender so that messages addressed to suppressed addresses are skipped with a
+// SuppressedError
+func NewSuppressingSender(sender Sender, store SuppressionStore, logger logrus.FieldLogger) Sender {
+	logger = logger.WithField("scope", "SuppressingSender")
+	return func(email *mail.SGMailV3) error {
+		for _, to := range ToAddresses(email) {
+			suppression, err := store.FindSuppression(to)
+			if err != nil {
+				return fmt.Errorf("could not check suppression list: %v", err)
+			}
+			if suppression != nil {
+				logger.WithFields(logrus.Fields{
+					"to":          to,
+					"template_id": email.TemplateID,
+					"reason":      suppression.Reason,
+				}).Warn("skipping email to suppressed address")
+				return &SuppressedError{Suppression: suppression}
+			}
+		}
+		return sender(email)
+	}
+}
+
+// SuppressFromEvents suppresses the addresses of hard bounces and spam reports in events
+func SuppressFromEvents(store SuppressionStore, events []*Event) error {
+	for _, e := range events {
+		var reason SuppressionReason
+		switch {
+		case e.Type == Bounce && e.BounceType != "blocked":
+			// 'blocked' bounces are soft so we may try again later
+			reason = SuppressedBounce
+		case e.Type == SpamReport:
+			reason = SuppressedSpamReport
+		default:
+			continue
+		}
+		err := store.Suppress(&Suppression{
+			Email:     e.Email,
+			Reason:    reason,
+			Detail:    e.Reason,
+			CreatedAt: e.Timestamp,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memorySuppressionStore struct {
+	sync.RWMutex
+	suppressions map[string]*Suppression
+}
+
+// NewMemorySuppressionStore returns a SuppressionStore that does not persist, useful for testing and development
+func NewMemorySuppressionStore() SuppressionStore {
+	return &memorySuppressionStore{
+		suppressions: make(map[string]*Suppression),
+	}
+}
+
+func (s *memorySuppressionStore) Suppress(suppression *Suppression) error {
+	s.Lock()
+	defer s.Unlock()
+	s.suppressions[suppressionKey(suppression.Email)] = suppression
+	return nil
+}
+
+func (s *memorySuppressionStore) Unsuppress(email string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.suppressions[suppressionKey(email)]
+	delete(s.suppressions, suppressionKey(email))
+	return ok, nil
+}
+
+func (s *memorySuppressionStore) FindSuppression(email string) (*Suppression, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.suppressions[suppressionKey(email)], nil
+}
+
+func suppressionKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
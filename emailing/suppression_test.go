@@ -0,0 +1,44 @@
+package emailing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuppressingSender(t *testing.T) {
+	store := NewMemorySuppressionStore()
+	err := store.Suppress(&Suppression{Email: "Bounced@monax.io", Reason: SuppressedBounce})
+	require.NoError(t, err)
+	var sent []string
+	sender := NewSuppressingSender(func(email *mail.SGMailV3) error {
+		sent = append(sent, ToAddresses(email)...)
+		return nil
+	}, store, logrus.New())
+
+	send := func(to string) error {
+		m, err := NewMessage("template-1", to, mail.NewEmail("", "noreply@monax.io"), testParams{})
+		require.NoError(t, err)
+		return sender(m)
+	}
+
+	require.NoError(t, send("cora@monax.io"))
+	assert.Equal(t, []string{"cora@monax.io"}, sent)
+
+	err = send("bounced@MONAX.io")
+	var suppressed *SuppressedError
+	require.True(t, errors.As(err, &suppressed), "suppressed addresses are matched case-insensitively")
+	assert.Equal(t, SuppressedBounce, suppressed.Suppression.Reason)
+	assert.True(t, suppressed.Permanent())
+	assert.Equal(t, []string{"cora@monax.io"}, sent, "suppressed message is not passed on")
+
+	ok, err := store.Unsuppress("bounced@monax.io")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, send("bounced@monax.io"))
+	assert.Equal(t, []string{"cora@monax.io", "bounced@monax.io"}, sent)
+}
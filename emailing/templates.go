@@ -0,0 +1,205 @@
+package emailing
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sendgrid/rest"
+	"golang.org/x/text/language"
+)
+
+// Purpose names what an email is for independently of the provider template that renders it
+type Purpose string
+
+// all known email purposes
+const (
+	PurposeSignup               Purpose = "Signup"
+	PurposeAlreadyRegistered    Purpose = "AlreadyRegistered"
+	PurposePasswordReset        Purpose = "PasswordReset"
+	PurposePasswordResetNewUser Purpose = "PasswordResetNewUser"
+	PurposePasswordResetExpired Purpose = "PasswordResetExpired"
+	PurposePasswordResetUnknown Purpose = "PasswordResetUnknown"
+	PurposeVerifyEmail          Purpose = "VerifyEmail"
+	PurposeEmailChangeNotice    Purpose = "EmailChangeNotice"
+	PurposeEmailChanged         Purpose = "EmailChanged"
+	PurposeLogin                Purpose = "Login"
+)
+
+// TemplateParams is implemented by the struct declaring the variables the template for a purpose is rendered with
+type TemplateParams interface {
+	// Purpose of the template the params are for
+	Purpose() Purpose
+	// Params returns the template variables keyed by name
+	Params() map[string]interface{}
+}
+
+// Templates maps purposes to template IDs, a purpose missing from the map falls back to the default template
+type Templates map[Purpose]string
+
+// MatchLocale picks the best of supported locales for the requested locale (a BCP 47 tag such as 'fr-CA').
+// Returns false when nothing in supported is a reasonable match.
+func MatchLocale(locale string, supported []string) (string, bool) {
+	if locale == "" || len(supported) == 0 {
+		return "", false
+	}
+	requested, err := language.Parse(locale)
+	if err != nil {
+		return "", false
+	}
+	// Sort so that matching is deterministic when supported is drawn from map keys
+	supported = append([]string(nil), supported...)
+	sort.Strings(supported)
+	// The matcher falls back to the first tag, so make that a sentinel meaning 'no match'
+	tags := []language.Tag{language.Und}
+	for _, s := range supported {
+		tags = append(tags, language.Make(s))
+	}
+	_, index, confidence := language.NewMatcher(tags).Match(requested)
+	if index == 0 || confidence == language.No {
+		return "", false
+	}
+	return supported[index-1], true
+}
+
+// ParamTag names the template variable a field of a params struct is rendered as
+const ParamTag = "param"
+
+// StructParams returns the template data of a params struct, or pointer to one, from its fields tagged with ParamTag
+// including those of embedded structs. Deriving TemplateParams.Params from fields this way means the variables
+// templates are checked against are exactly those sent.
+func StructParams(params interface{}) map[string]interface{} {
+	data := make(map[string]interface{})
+	addStructParams(reflect.Indirect(reflect.ValueOf(params)), data)
+	return data
+}
+
+func addStructParams(v reflect.Value, data map[string]interface{}) {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if name := field.Tag.Get(ParamTag); name != "" && name != "-" {
+			data[name] = v.Field(i).Interface()
+		} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addStructParams(v.Field(i), data)
+		}
+	}
+}
+
+// Template variables that may be set on any message by a Sender rather than by TemplateParams
+var senderVariables = map[string]bool{
+	OriginalRecipientParam: true,
+}
+
+// TemplateInspector reports the variables a provider template references
+type TemplateInspector interface {
+	TemplateVariables(templateID string) ([]string, error)
+}
+
+// CheckTemplate returns an error if the template references variables that are not in params, as given by the keys
+// of zero params. It is not an error for the template to ignore some params.
+func CheckTemplate(inspector TemplateInspector, templateID string, params TemplateParams) error {
+	variables, err := inspector.TemplateVariables(templateID)
+	if err != nil {
+		return fmt.Errorf("could not inspect template %s for %s: %v", templateID, params.Purpose(), err)
+	}
+	fields := params.Params()
+	var missing []string
+	for _, v := range variables {
+		if _, ok := fields[v]; !ok && !senderVariables[v] {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("template %s for %s references variables %s that are not in %T",
+			templateID, params.Purpose(), strings.Join(missing, ", "), params)
+	}
+	return nil
+}
+
+// Matches the opening of a handlebars expression and its first token, e.g. '{{#if foo' or '{{{ bar'
+var handlebarsExpression = regexp.MustCompile(`{{{?\s*([#^/]?)\s*([\w.@]+)((?:\s+[\w.@]+)*)`)
+
+// Handlebars built in and SendGrid helpers whose arguments, rather than themselves, are variables
+var handlebarsHelpers = map[string]bool{
+	"if": true, "unless": true, "each": true, "with": true, "else": true, "equals": true, "notEquals": true,
+	"and": true, "or": true, "greaterThan": true, "lessThan": true, "length": true, "formatDate": true,
+	"insert": true,
+}
+
+// HandlebarsVariables returns the root variables referenced by a handlebars template in sorted order
+func HandlebarsVariables(template string) []string {
+	found := make(map[string]bool)
+	add := func(token string) {
+		root := strings.Split(token, ".")[0]
+		if root == "" || root == "this" || strings.HasPrefix(root, "@") || handlebarsHelpers[root] {
+			return
+		}
+		found[root] = true
+	}
+	for _, match := range handlebarsExpression.FindAllStringSubmatch(template, -1) {
+		if match[1] == "/" {
+			// Closing block
+			continue
+		}
+		add(match[2])
+		if handlebarsHelpers[match[2]] {
+			for _, arg := range strings.Fields(match[3]) {
+				add(arg)
+			}
+		}
+	}
+	variables := make([]string, 0, len(found))
+	for v := range found {
+		variables = append(variables, v)
+	}
+	sort.Strings(variables)
+	return variables
+}
+
+type sendgridTemplateInspector struct {
+	client *sendgridClient
+}
+
+// NewSendgridTemplateInspector returns a TemplateInspector reading the active version of SendGrid dynamic templates
+// from the API reached as configured by cfg, which may be nil for the defaults
+func NewSendgridTemplateInspector(credentials string, cfg *SendgridConfig) (TemplateInspector, error) {
+	client, err := newSendgridClient(credentials, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &sendgridTemplateInspector{client: client}, nil
+}
+
+type sendgridTemplate struct {
+	Versions []struct {
+		Active       int    `json:"active"`
+		Subject      string `json:"subject"`
+		HTMLContent  string `json:"html_content"`
+		PlainContent string `json:"plain_content"`
+	} `json:"versions"`
+}
+
+func (i *sendgridTemplateInspector) TemplateVariables(templateID string) ([]string, error) {
+	resp, err := i.client.client.Send(i.client.request(rest.Get, "/v3/templates/"+templateID))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("SendGrid responded with failure status: %v", resp.StatusCode)
+	}
+	template := new(sendgridTemplate)
+	err = json.Unmarshal([]byte(resp.Body), template)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range template.Versions {
+		if v.Active == 1 {
+			return HandlebarsVariables(v.Subject + v.HTMLContent + v.PlainContent), nil
+		}
+	}
+	return nil, fmt.Errorf("template has no active version")
+}
@@ -0,0 +1,67 @@
+package emailing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testParams map[string]interface{}
+
+func (testParams) Purpose() Purpose {
+	return PurposeSignup
+}
+
+func (p testParams) Params() map[string]interface{} {
+	return p
+}
+
+type staticInspector []string
+
+func (i staticInspector) TemplateVariables(templateID string) ([]string, error) {
+	return i, nil
+}
+
+func TestHandlebarsVariables(t *testing.T) {
+	template := `<p>Hi {{ name }},</p>
+{{#if token_link}}<a href="{{{token_link}}}">Sign up</a>{{else}}{{token}}{{/if}}
+{{#each items}}{{this.title}} {{@index}}{{/each}}
+{{#equals account.plan "pro"}}Pro{{/equals}}`
+	assert.Equal(t, []string{"account", "items", "name", "token", "token_link"}, HandlebarsVariables(template))
+}
+
+func TestCheckTemplate(t *testing.T) {
+	params := testParams{"token": "", "token_link": ""}
+	assert.NoError(t, CheckTemplate(staticInspector{"token_link"}, "id", params))
+	assert.NoError(t, CheckTemplate(staticInspector{"token", OriginalRecipientParam}, "id", params))
+	assert.Error(t, CheckTemplate(staticInspector{"token", "name"}, "id", params))
+}
+
+func TestMatchLocale(t *testing.T) {
+	supported := []string{"pt", "fr", "en-US"}
+	for requested, expected := range map[string]string{
+		"fr-CA": "fr",
+		"pt-BR": "pt",
+		"en-GB": "en-US",
+		"de":    "",
+		"":      "",
+	} {
+		matched, _ := MatchLocale(requested, supported)
+		assert.Equal(t, expected, matched, "matching %s", requested)
+	}
+}
+
+func TestStructParams(t *testing.T) {
+	type linkParams struct {
+		Link string `param:"link"`
+	}
+	type params struct {
+		linkParams
+		Name     string `param:"name"`
+		Ignored  string `param:"-"`
+		Untagged string
+	}
+	assert.Equal(t, map[string]interface{}{"link": "https://monax.io", "name": "Cora"},
+		StructParams(&params{linkParams{"https://monax.io"}, "Cora", "x", "y"}))
+	assert.Equal(t, map[string]interface{}{"link": "", "name": ""}, StructParams(params{}))
+}
@@ -0,0 +1,78 @@
+package emailing
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Headers carrying the signature of a SendGrid Signed Event Webhook request
+const (
+	WebhookSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	WebhookTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+)
+
+// DefaultWebhookTolerance is how far a signed webhook timestamp may be from our clock when no tolerance is configured
+const DefaultWebhookTolerance = 5 * time.Minute
+
+// WebhookVerifier checks SendGrid Signed Event Webhook requests
+type WebhookVerifier struct {
+	publicKey *ecdsa.PublicKey
+	// Requests signed further than this from now are rejected as replays
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+// NewWebhookVerifier takes the verification key as shown in the SendGrid mail settings, that is a base64 encoded
+// DER ECDSA public key, and how far a request's signed timestamp may be from now, defaulting to
+// DefaultWebhookTolerance
+func NewWebhookVerifier(verificationKey string, tolerance time.Duration) (*WebhookVerifier, error) {
+	der, err := base64.StdEncoding.DecodeString(verificationKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode webhook verification key: %v", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse webhook verification key: %v", err)
+	}
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("webhook verification key must be an ECDSA key but got %T", key)
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultWebhookTolerance
+	}
+	return &WebhookVerifier{
+		publicKey: publicKey,
+		tolerance: tolerance,
+		now:       time.Now,
+	}, nil
+}
+
+// Verify checks signature (from WebhookSignatureHeader) over timestamp (from WebhookTimestampHeader) and the raw
+// request body, and that timestamp, in Unix seconds, is within the tolerance of now
+func (v *WebhookVerifier) Verify(payload []byte, signature, timestamp string) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("could not parse webhook timestamp: %v", err)
+	}
+	skew := v.now().Sub(time.Unix(seconds, 0))
+	if skew > v.tolerance || skew < -v.tolerance {
+		return fmt.Errorf("webhook timestamp %s is outside the tolerance of %v", timestamp, v.tolerance)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("could not decode webhook signature: %v", err)
+	}
+	digest := sha256.New()
+	digest.Write([]byte(timestamp))
+	digest.Write(payload)
+	if !ecdsa.VerifyASN1(v.publicKey, digest.Sum(nil), sig) {
+		return fmt.Errorf("webhook signature is not valid")
+	}
+	return nil
+}
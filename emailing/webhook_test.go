@@ -0,0 +1,51 @@
+package emailing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	verifier, err := NewWebhookVerifier(base64.StdEncoding.EncodeToString(der), time.Minute)
+	require.NoError(t, err)
+	now := time.Now()
+	verifier.now = func() time.Time { return now }
+
+	payload := []byte(`[{"event":"delivered"}]`)
+	sign := func(timestamp string) string {
+		digest := sha256.Sum256(append([]byte(timestamp), payload...))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+	at := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(d).Unix(), 10)
+	}
+
+	timestamp := at(0)
+	assert.NoError(t, verifier.Verify(payload, sign(timestamp), timestamp))
+	timestamp = at(-50 * time.Second)
+	assert.NoError(t, verifier.Verify(payload, sign(timestamp), timestamp), "within tolerance")
+	assert.Error(t, verifier.Verify([]byte(`[]`), sign(timestamp), timestamp), "payload altered")
+	assert.Error(t, verifier.Verify(payload, sign(timestamp), at(-40*time.Second)), "timestamp altered")
+
+	timestamp = at(-2 * time.Minute)
+	assert.Error(t, verifier.Verify(payload, sign(timestamp), timestamp), "replayed")
+	timestamp = at(2 * time.Minute)
+	assert.Error(t, verifier.Verify(payload, sign(timestamp), timestamp), "from the future")
+	assert.Error(t, verifier.Verify(payload, sign("yesterday"), "yesterday"))
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"github.com/keratin/authn-server/server/handlers"
+)
+
+// DeleteEmailSuppression swagger:route DELETE /email/suppressions unsuppressEmail
+// Remove an address from the suppression list, for example once a user has fixed their mailbox.
+// This is an administrative endpoint and should only be mounted behind admin authentication.
+// Responses:
+//   404:
+//   422: fieldErrors
+func DeleteEmailSuppression(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if err = r.ParseForm(); err != nil {
+			panic(err)
+		}
+
+		args := new(EmailSuppressionArgs)
+		if err = Decode(r.Form, args); !HandleError(w, err) {
+			return
+		}
+
+		ok, err := app.EmailSuppressions.Unsuppress(args.Email)
+		if err != nil {
+			panic(err)
+		}
+		if !ok {
+			handlers.WriteNotFound(w, "email")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
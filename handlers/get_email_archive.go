@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/emailing"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// swagger:parameters emailArchive
+type EmailArchiveArgs struct {
+	// in: query
+	AccountID int `json:"account_id" schema:"account_id"`
+	// in: query
+	Email string `json:"email"`
+}
+
+// GetEmailArchive swagger:route GET /email/archive emailArchive
+// List the archived messages we tried to send concerning an account or to an address, with the outcome of each.
+// This is an administrative endpoint and should only be mounted behind admin authentication.
+// Responses:
+//   200: emailArchive
+//   422: fieldErrors
+func GetEmailArchive(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.EmailArchive == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		args := new(EmailArchiveArgs)
+		if err := Decode(r.URL.Query(), args); !HandleError(w, err) {
+			return
+		}
+
+		var messages []*emailing.ArchivedMessage
+		var err error
+		if args.Email != "" {
+			messages, err = app.EmailArchive.FindArchivedByRecipient(args.Email)
+		} else {
+			messages, err = app.EmailArchive.FindArchivedByAccountID(args.AccountID)
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		WriteData(w, http.StatusOK, EmailArchiveResult{Messages: messages})
+	}
+}
+
+// swagger:response emailArchive
+type EmailArchiveResult struct {
+	// in: body
+	Messages []*emailing.ArchivedMessage `json:"messages"`
+}
+
+func (args *EmailArchiveArgs) Validate() error {
+	if args.Email != "" {
+		return normalizeEmail("email", &args.Email)
+	}
+	if args.AccountID == 0 {
+		return validation.Errors{"account_id": errors.New("one of account_id or email is required")}
+	}
+	return nil
+}
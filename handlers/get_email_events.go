@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/emailing"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// swagger:parameters emailEvents
+type EmailEventsArgs struct {
+	// in: query
+	AccountID int `json:"account_id" schema:"account_id"`
+	// in: query
+	MessageID string `json:"message_id" schema:"message_id"`
+}
+
+// GetEmailEvents swagger:route GET /email/events emailEvents
+// List the delivery events recorded for a message or for all messages concerning an account.
+// This is an administrative endpoint and should only be mounted behind admin authentication.
+// Responses:
+//   200: emailEvents
+//   422: fieldErrors
+func GetEmailEvents(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		args := new(EmailEventsArgs)
+		if err := Decode(r.URL.Query(), args); !HandleError(w, err) {
+			return
+		}
+
+		var events []*emailing.Event
+		var err error
+		if args.MessageID != "" {
+			events, err = app.EmailEvents.FindEventsByMessageID(args.MessageID)
+		} else {
+			events, err = app.EmailEvents.FindEventsByAccountID(args.AccountID)
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		WriteData(w, http.StatusOK, EmailEventsResult{Events: events})
+	}
+}
+
+// swagger:response emailEvents
+type EmailEventsResult struct {
+	// in: body
+	Events []*emailing.Event `json:"events"`
+}
+
+func (args *EmailEventsArgs) Validate() error {
+	if args.AccountID == 0 && args.MessageID == "" {
+		return validation.Errors{"account_id": errors.New("one of account_id or message_id is required")}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/services"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// swagger:parameters emailPreview
+type EmailPreviewArgs struct {
+	// The purpose of the template to render, e.g. 'Signup' or 'PasswordResetExpired'
+	// in: query
+	// required: true
+	Purpose string `json:"purpose"`
+	// Optional BCP 47 language tag selecting a localised template
+	// in: query
+	Locale string `json:"locale"`
+	// Optional application domain selecting a brand, as it appears in the application domains configured
+	// in: query
+	Domain string `json:"domain"`
+	// Optional recipient address
+	// in: query
+	To string `json:"to"`
+	// Optional JSON object of template variables overriding the sample values
+	// in: query
+	Data string `json:"data"`
+}
+
+// GetEmailPreview swagger:route GET /email/preview emailPreview
+// Render the template configured for a purpose with sample or supplied data through the configured sender's
+// rendering path, without sending anything. For SendGrid this is the payload of the send request.
+// This is an administrative endpoint and should only be mounted behind admin authentication.
+// Responses:
+//   200: emailPreview
+//   422: fieldErrors
+func GetEmailPreview(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		args := new(EmailPreviewArgs)
+		if err := Decode(r.URL.Query(), args); !HandleError(w, err) {
+			return
+		}
+
+		mc := services.MailContext{Locale: args.Locale, Domain: args.Domain}
+		preview, err := services.EmailPreviewer(app.Config, app.EmailRenderer, emailing.Purpose(args.Purpose), mc,
+			args.To, args.data())
+		if !HandleError(w, err) {
+			return
+		}
+
+		WriteData(w, http.StatusOK, EmailPreviewResult{Preview: preview})
+	}
+}
+
+// swagger:response emailPreview
+type EmailPreviewResult struct {
+	// in: body
+	Preview *emailing.Preview `json:"preview"`
+}
+
+func (args *EmailPreviewArgs) Validate() error {
+	return validation.ValidateStruct(args,
+		validation.Field(&args.Purpose, validation.Required),
+		validation.Field(&args.Locale, isLocale),
+		validation.Field(&args.Data, validation.By(func(value interface{}) error {
+			if args.Data != "" && args.data() == nil {
+				return errors.New("must be a JSON object")
+			}
+			return nil
+		})))
+}
+
+func (args *EmailPreviewArgs) data() map[string]interface{} {
+	var data map[string]interface{}
+	if args.Data != "" {
+		_ = json.Unmarshal([]byte(args.Data), &data)
+	}
+	return data
+}
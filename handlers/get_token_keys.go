@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/tokens"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// How long clients may cache the key set. Keys verify tokens as soon as they are configured, before they sign, so a
+// rotation is published well before clients need the new key.
+const tokenKeysMaxAge = 5 * time.Minute
+
+// GetTokenKeys swagger:route GET /tokens/jwks tokenKeys
+// Publish the public keys that verify the tokens we send by email, as a JSON Web Key Set, so that other services can
+// verify them without sharing a secret. Tokens signed with HMAC keys can only be verified by pericyte.
+// The body is the bare key set rather than a result envelope, as JWKS clients expect. It is public so is mounted
+// without a session, next to keratin's own /jwks.
+// Responses:
+//   200: tokenKeys
+func GetTokenKeys(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(tokenKeysMaxAge.Seconds())))
+		WriteData(w, http.StatusOK, tokens.Keyring(app.Config).PublicKeys())
+	}
+}
+
+// swagger:response tokenKeys
+type TokenKeysResult struct {
+	// in: body
+	Body jose.JSONWebKeySet
+}
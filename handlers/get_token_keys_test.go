@@ -0,0 +1,53 @@
+package handlers_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"code.monax.io/monax/pericyte/handlers"
+	"code.monax.io/monax/pericyte/test"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/keys"
+	"github.com/test-go/testify/assert"
+	"github.com/test-go/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestGetTokenKeys(t *testing.T) {
+	app := test.App()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(private)
+	require.NoError(t, err)
+	app.Config.PasswordlessTokenKeys = []*keys.Key{
+		{ID: "ec", PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))},
+		{ID: "hmac", Secret: "key-a-reno", ActiveFrom: time.Now().Add(-time.Hour)},
+	}
+	require.NoError(t, tokens.Keyring(app.Config).Load(time.Now()))
+
+	resp := httptest.NewRecorder()
+	handlers.GetTokenKeys(app)(resp, httptest.NewRequest(http.MethodGet, "/tokens/jwks", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "public, max-age=300", resp.Header().Get("Cache-Control"))
+
+	// JWKS clients expect the key set itself, not wrapped in a result
+	var body map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Len(t, body, 1)
+	require.Contains(t, body, "keys")
+
+	var set jose.JSONWebKeySet
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &set))
+	require.Len(t, set.Keys, 1, "HMAC keys are not published")
+	assert.Equal(t, "ec", set.Keys[0].KeyID)
+	assert.Equal(t, string(jose.ES256), set.Keys[0].Algorithm)
+	assert.True(t, private.PublicKey.Equal(set.Keys[0].Key), "the public half of the signing key is published")
+}
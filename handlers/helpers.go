@@ -5,6 +5,7 @@ import (
 	"net/url"
 
 	"code.monax.io/monax/pericyte/data"
+	"code.monax.io/monax/pericyte/emailaddress"
 	"code.monax.io/monax/pericyte/models"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/gorilla/schema"
@@ -49,11 +50,13 @@ func HandleError(w http.ResponseWriter, err error) (ok bool) {
 		return true
 	}
 	var fieldErrors kservices.FieldErrors
+	var suggestions map[string]string
 	switch e := err.(type) {
 	case kservices.FieldErrors:
 		fieldErrors = e
 	case validation.Errors:
 		fieldErrors = fieldErrorsFromMap(e)
+		suggestions = suggestionsFromMap(e)
 	case schema.MultiError:
 		fieldErrors = fieldErrorsFromMap(e)
 	default:
@@ -61,7 +64,8 @@ func HandleError(w http.ResponseWriter, err error) (ok bool) {
 	}
 
 	if len(fieldErrors) > 0 {
-		WriteErrors(w, fieldErrors)
+		handlers.WriteJSON(w, http.StatusUnprocessableEntity, ServiceErrors{Errors: fieldErrors,
+			Suggestions: suggestions})
 		return false
 	}
 	return true
@@ -82,9 +86,34 @@ func GetUserAccount(store data.UserStore, accountID int, w http.ResponseWriter,
 }
 
 func fieldErrorsFromMap(errs map[string]error) kservices.FieldErrors {
-	fieldErrors := make(kservices.FieldErrors, len(errs), 0)
+	fieldErrors := make(kservices.FieldErrors, 0, len(errs))
 	for k, v := range errs {
 		fieldErrors = append(fieldErrors, kservices.FieldError{Field: k, Message: v.Error()})
 	}
 	return fieldErrors
 }
+
+// suggestionsFromMap returns the corrected addresses of fields rejected as typos
+func suggestionsFromMap(errs map[string]error) map[string]string {
+	var suggestions map[string]string
+	for k, v := range errs {
+		if qualityErr, ok := v.(*emailaddress.QualityError); ok && qualityErr.Suggestion != "" {
+			if suggestions == nil {
+				suggestions = make(map[string]string)
+			}
+			suggestions[k] = qualityErr.Suggestion
+		}
+	}
+	return suggestions
+}
+
+// normalizeEmail normalizes the address in email in place, returning a FORMAT_INVALID error against field if it is
+// not a valid address
+func normalizeEmail(field string, email *string) error {
+	normalized, err := emailaddress.Normalize(*email)
+	if err != nil {
+		return kservices.FieldErrors{{Field: field, Message: kservices.ErrFormatInvalid}}
+	}
+	*email = normalized
+	return nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"code.monax.io/monax/pericyte/services"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/keratin/authn-server/lib/route"
+	"golang.org/x/text/language"
+)
+
+// Validation rule for optional locale arguments
+var isLocale = validation.By(func(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	if _, err := language.Parse(s); err != nil {
+		return errors.New("must be a BCP 47 language tag")
+	}
+	return nil
+})
+
+// RequestMailContext collects the details of the request that email sent on behalf of it should reflect. An explicit
+// locale takes precedence over the Accept-Language header. The application domain is the one keratin matched against
+// the Origin or Referer of the request.
+func RequestMailContext(r *http.Request, locale string) services.MailContext {
+	mc := services.MailContext{
+		Locale: requestLocale(r, locale),
+	}
+	if domain := route.MatchedDomain(r); domain != nil {
+		mc.Domain = domain.String()
+	}
+	return mc
+}
+
+func requestLocale(r *http.Request, locale string) string {
+	if tag, err := language.Parse(locale); err == nil {
+		return tag.String()
+	}
+	// Ordered by quality
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil || len(tags) == 0 || tags[0] == language.Und {
+		return ""
+	}
+	return tags[0].String()
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/services"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// swagger:parameters revertEmail
+type EmailRevertArgs struct {
+	// The token from the link sent to the previous address when the change was requested
+	// in: formData
+	// required: true
+	Token string `json:"token"`
+}
+
+// PostEmailRevert swagger:route POST /email/revert revertEmail
+// Restore the email address an account had before a change was requested. This is the "this wasn't me" link sent to
+// the previous address so no session is needed. The password is expired and sessions are ended, so the user must
+// then reset their password.
+// Consumes:
+// - application/x-www-form-urlencoded
+// Responses:
+//   422: fieldErrors
+func PostEmailRevert(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic(err)
+		}
+
+		args := new(EmailRevertArgs)
+		if err = Decode(r.Form, args); !HandleError(w, err) {
+			return
+		}
+
+		_, err = services.EmailReverter(app.UserStore, app.AccountStore, app.RefreshTokenStore,
+			app.TokenRedemptions, app.Config, args.Token)
+		if !HandleError(w, err) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (args *EmailRevertArgs) Validate() error {
+	return validation.ValidateStruct(args,
+		validation.Field(&args.Token, validation.Required))
+}
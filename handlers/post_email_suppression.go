@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/models"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// swagger:parameters suppressEmail unsuppressEmail
+type EmailSuppressionArgs struct {
+	// in: formData
+	// required: true
+	Email string `json:"email"`
+	// A note on why the address is suppressed
+	// in: formData
+	Detail string `json:"detail"`
+}
+
+// PostEmailSuppression swagger:route POST /email/suppressions suppressEmail
+// Add an address to the suppression list so that no email is sent to it.
+// This is an administrative endpoint and should only be mounted behind admin authentication.
+// Consumes:
+// - application/x-www-form-urlencoded
+// Responses:
+//   422: fieldErrors
+func PostEmailSuppression(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if err = r.ParseForm(); err != nil {
+			panic(err)
+		}
+
+		args := new(EmailSuppressionArgs)
+		if err = Decode(r.Form, args); !HandleError(w, err) {
+			return
+		}
+
+		err = app.EmailSuppressions.Suppress(&emailing.Suppression{
+			Email:     args.Email,
+			Reason:    emailing.SuppressedManual,
+			Detail:    args.Detail,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (args *EmailSuppressionArgs) Validate() error {
+	err := validation.ValidateStruct(args,
+		validation.Field(&args.Email, validation.Required, validation.Length(1, models.MaximumNameEmailLength)))
+	if err != nil {
+		return err
+	}
+	return normalizeEmail("email", &args.Email)
+}
@@ -5,6 +5,7 @@ import (
 
 	"code.monax.io/monax/pericyte"
 	"code.monax.io/monax/pericyte/models"
+	"code.monax.io/monax/pericyte/services"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/keratin/authn-server/server/sessions"
 )
@@ -14,6 +15,9 @@ type EmailVerifyArgs struct {
 	// in: formData
 	// required: true
 	Email string `json:"email"`
+	// Optional BCP 47 language tag for emails sent, defaults to the Accept-Language header
+	// in: formData
+	Locale string `json:"locale"`
 }
 
 // PostEmailVerify swagger:route POST /email/verify verifyEmail
@@ -42,8 +46,12 @@ func PostEmailVerify(app *pericyte.App) http.HandlerFunc {
 		if err = Decode(r.Form, args); !HandleError(w, err) {
 			return
 		}
+		err = services.SuppressionChecker(app.EmailSuppressions, "email", args.Email)
+		if !HandleError(w, err) {
+			return
+		}
 
-		err = app.Dispatchers.VerifyEmail(accountID, args.Email)
+		err = app.Dispatchers.VerifyEmail(accountID, args.Email, RequestMailContext(r, args.Locale))
 		if err != nil {
 			panic(err)
 		}
@@ -53,6 +61,11 @@ func PostEmailVerify(app *pericyte.App) http.HandlerFunc {
 }
 
 func (args *EmailVerifyArgs) Validate() error {
-	return validation.ValidateStruct(args,
-		validation.Field(&args.Email, validation.Required, validation.Length(1, models.MaximumNameEmailLength)))
+	err := validation.ValidateStruct(args,
+		validation.Field(&args.Email, validation.Required, validation.Length(1, models.MaximumNameEmailLength)),
+		validation.Field(&args.Locale, isLocale))
+	if err != nil {
+		return err
+	}
+	return normalizeEmail("email", &args.Email)
 }
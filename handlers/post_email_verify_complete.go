@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/services"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/keratin/authn-server/server/sessions"
+)
+
+// swagger:parameters completeEmailVerify
+type EmailVerifyCompleteArgs struct {
+	// The token from the link sent to the new address
+	// in: formData
+	// required: true
+	Token string `json:"token"`
+	// Optional BCP 47 language tag for emails sent, defaults to the Accept-Language header
+	// in: formData
+	Locale string `json:"locale"`
+}
+
+// PostEmailVerifyComplete swagger:route POST /email/verify/complete completeEmailVerify
+// Change the email address of the logged in user to the address verified by the token sent by /email/verify, and
+// send a confirmation to it. When token only email changes are configured no session is needed. Either way a revert
+// from the previous address cancels any pending change, as it expires the password the token is bound to.
+// Consumes:
+// - application/x-www-form-urlencoded
+// Responses:
+//   422: fieldErrors
+func PostEmailVerifyComplete(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountID := sessions.GetAccountID(r)
+		if accountID == 0 && !app.Config.Email.TokenOnlyEmailChange {
+			WriteUnauthorized(w)
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			panic(err)
+		}
+
+		args := new(EmailVerifyCompleteArgs)
+		if err = Decode(r.Form, args); !HandleError(w, err) {
+			return
+		}
+
+		accountID, email, err := services.EmailChangeCompleter(app.UserStore, app.TokenRedemptions, app.Config, accountID,
+			args.Token)
+		if !HandleError(w, err) {
+			return
+		}
+
+		err = app.Dispatchers.EmailChanged(accountID, email, RequestMailContext(r, args.Locale))
+		if err != nil {
+			panic(err)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (args *EmailVerifyCompleteArgs) Validate() error {
+	return validation.ValidateStruct(args,
+		validation.Field(&args.Token, validation.Required),
+		validation.Field(&args.Locale, isLocale))
+}
@@ -5,15 +5,23 @@ import (
 	"net/url"
 	"testing"
 
+	"code.monax.io/monax/pericyte/emailing"
 	"code.monax.io/monax/pericyte/services"
 	"code.monax.io/monax/pericyte/test"
 	"code.monax.io/monax/pericyte/test/mock"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/emailrevert"
+	"code.monax.io/monax/pericyte/tokens/emailverify"
+	"code.monax.io/monax/pericyte/tokens/redemption"
+	kservices "github.com/keratin/authn-server/app/services"
 	"github.com/test-go/testify/assert"
 	"github.com/test-go/testify/require"
 )
 
 func TestPostEmailVerify(t *testing.T) {
 	app := test.App()
+	app.TokenRedemptions = redemption.NewMemoryStore()
+	app.Config.Email.TemplatesIDs.EmailChangeNotice = "email-change-notice"
 	emailClient := mock.NewEmailClient()
 	test.WithEmailClient(app, emailClient.Sender())
 	srv := test.NewServer(app)
@@ -38,9 +46,234 @@ func TestPostEmailVerify(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 
-	token := test.GetTokenFromEmail(t, test.GetEmail(t, emailClient))
-	accountID, verifiedEmail, err := services.VerifyEmailVerifier(token, app.Config)
+	verifyEmail := test.GetEmail(t, emailClient)
+	assert.Equal(t, []string{emailUpdated}, emailing.ToAddresses(verifyEmail), "verification goes to the new address")
+	token := test.GetTokenFromEmail(t, verifyEmail)
+	accountID, verifiedEmail, err := services.VerifyEmailVerifier(app.UserStore, app.Config, token)
 	require.NoError(t, err)
 	assert.Equal(t, emailUpdated, verifiedEmail)
 	assert.Equal(t, user.AccountID, accountID)
+
+	notice := test.GetEmail(t, emailClient)
+	assert.Equal(t, "email-change-notice", notice.TemplateID)
+	assert.Equal(t, []string{email}, emailing.ToAddresses(notice), "the notice goes to the previous address")
+	assert.Equal(t, emailUpdated, emailing.TemplateData(notice)["new_email"])
+	revertToken := test.GetTokenFromEmail(t, notice)
+	claims, err := emailrevert.Parse(revertToken, app.Config)
+	require.NoError(t, err)
+	assert.Equal(t, email, claims.Subject)
+	assert.Equal(t, emailUpdated, claims.NewEmail)
+
+	// Complete the change then revert it from the notice
+	resp, err = client.PostForm("/email/verify/complete", url.Values{"token": []string{token}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = test.NewClient(app, srv.URL).PostForm("/email/revert", url.Values{"token": []string{revertToken}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	reverted, err := app.UserStore.FindUserByAccountID(user.AccountID)
+	require.NoError(t, err)
+	assert.Equal(t, email, reverted.Email)
+}
+
+func TestPostEmailRevert(t *testing.T) {
+	app := test.App()
+	app.TokenRedemptions = redemption.NewMemoryStore()
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	email := "okhuoh@co.co"
+	user := test.CreateUser(t, app, "MR FROG THE FOURTH", "thisisapassword", email)
+	require.NoError(t, services.EmailUpdater(app.UserStore, user.ID, "attacker@co.co"))
+	test.CreateUser(t, app, "MRS FROG", "thisisapassword", "taken@co.co")
+
+	revertToken := func(previousEmail, newEmail string) string {
+		claims, err := emailrevert.New(app.Config, user.AccountID, previousEmail, newEmail)
+		require.NoError(t, err)
+		token, err := claims.Sign(tokens.Keyring(app.Config))
+		require.NoError(t, err)
+		return token
+	}
+
+	client := test.NewClient(app, srv.URL)
+	resp, err := client.PostForm("/email/revert", url.Values{"token": []string{"not-a-token"}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp, err = client.PostForm("/email/revert", url.Values{"token": []string{revertToken(email, "earlier@co.co")}})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "token", kservices.ErrInvalidOrExpired)
+
+	resp, err = client.PostForm("/email/revert",
+		url.Values{"token": []string{revertToken("taken@co.co", "attacker@co.co")}})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "email", kservices.ErrTaken)
+
+	unchanged, err := app.UserStore.FindUserByAccountID(user.AccountID)
+	require.NoError(t, err)
+	assert.Equal(t, "attacker@co.co", unchanged.Email)
+	account, err := app.AccountStore.Find(user.AccountID)
+	require.NoError(t, err)
+	assert.False(t, account.RequireNewPassword, "rejected reverts leave the password alone")
+
+	token := revertToken(email, "attacker@co.co")
+	resp, err = client.PostForm("/email/revert", url.Values{"token": []string{token}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	reverted, err := app.UserStore.FindUserByAccountID(user.AccountID)
+	require.NoError(t, err)
+	assert.Equal(t, email, reverted.Email)
+	account, err = app.AccountStore.Find(user.AccountID)
+	require.NoError(t, err)
+	assert.True(t, account.RequireNewPassword, "password must be reset after a revert")
+
+	// The account still has the previous address so only redeeming the token stops it being used again
+	resp, err = client.PostForm("/email/revert", url.Values{"token": []string{token}})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "token", kservices.ErrInvalidOrExpired)
+}
+
+func TestPostEmailVerifyComplete(t *testing.T) {
+	app := test.App()
+	app.TokenRedemptions = redemption.NewMemoryStore()
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	username := "MR FROG THE FIFTH"
+	password := "thisisapassword"
+	user := test.CreateUser(t, app, username, password, "okhuoh@co.co")
+	test.CreateUser(t, app, "MRS FROG", password, "taken@co.co")
+
+	verifyToken := func(accountID int, email string) string {
+		claims, err := emailverify.New(app.Config, email)
+		require.NoError(t, err)
+		token, err := claims.WithAccountID(accountID).WithStamp(user.Email, user.PasswordChangedAt, false).
+			Sign(tokens.Keyring(app.Config))
+		require.NoError(t, err)
+		return token
+	}
+
+	client := test.NewClient(app, srv.URL)
+	resp, err := client.PostForm("/email/verify/complete",
+		url.Values{"token": []string{verifyToken(user.AccountID, "cora@monax.io")}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode, "must be logged in to complete a change")
+
+	client, err = test.Login(client, username, password, app.Config.SessionCookieName)
+	require.NoError(t, err)
+	for _, token := range []string{
+		verifyToken(user.AccountID, "taken@co.co"),
+		verifyToken(user.AccountID+1, "cora@monax.io"),
+		verifyToken(0, "cora@monax.io"),
+	} {
+		resp, err = client.PostForm("/email/verify/complete", url.Values{"token": []string{token}})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	}
+
+	// Tokens carry the address as requested so it is checked again before it is stored
+	resp, err = client.PostForm("/email/verify/complete",
+		url.Values{"token": []string{verifyToken(user.AccountID, "cora@monax")}})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "email", kservices.ErrFormatInvalid)
+
+	stale := verifyToken(user.AccountID, "second@monax.io")
+	resp, err = client.PostForm("/email/verify/complete",
+		url.Values{"token": []string{verifyToken(user.AccountID, "cora@monax.io")}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	changed, err := app.UserStore.FindUserByAccountID(user.AccountID)
+	require.NoError(t, err)
+	assert.Equal(t, "cora@monax.io", changed.Email)
+
+	resp, err = client.PostForm("/email/verify/complete", url.Values{"token": []string{stale}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode,
+		"changing the email invalidates tokens issued before")
+
+	// Restoring the address the token was stamped with leaves only its redemption to stop it being used again
+	used := verifyToken(user.AccountID, "second@monax.io")
+	require.NoError(t, services.EmailUpdater(app.UserStore, user.ID, user.Email))
+	resp, err = client.PostForm("/email/verify/complete", url.Values{"token": []string{used}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, services.EmailUpdater(app.UserStore, user.ID, user.Email))
+	resp, err = client.PostForm("/email/verify/complete", url.Values{"token": []string{used}})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "token", kservices.ErrInvalidOrExpired)
+}
+
+func TestPostEmailVerifyCompleteTokenOnly(t *testing.T) {
+	app := test.App()
+	app.TokenRedemptions = redemption.NewMemoryStore()
+	app.Config.Email.TokenOnlyEmailChange = true
+	app.Config.Email.TemplatesIDs.EmailChanged = "email-changed"
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	password := "thisisapassword"
+	user := test.CreateUser(t, app, "MR FROG THE SIXTH", password, "okhuoh@co.co")
+	test.CreateUser(t, app, "MRS FROG", password, "other@co.co")
+	claims, err := emailverify.New(app.Config, "cora@monax.io")
+	require.NoError(t, err)
+	token, err := claims.WithAccountID(user.AccountID).WithStamp(user.Email, user.PasswordChangedAt, false).
+		Sign(tokens.Keyring(app.Config))
+	require.NoError(t, err)
+
+	other, err := test.Login(test.NewClient(app, srv.URL), "MRS FROG", password, app.Config.SessionCookieName)
+	require.NoError(t, err)
+	resp, err := other.PostForm("/email/verify/complete", url.Values{"token": []string{token}})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "token", kservices.ErrInvalidOrExpired)
+
+	client := test.NewClient(app, srv.URL)
+	resp, err = client.PostForm("/email/verify/complete", url.Values{"token": []string{token}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, "the token alone completes the change")
+
+	changed, err := app.UserStore.FindUserByAccountID(user.AccountID)
+	require.NoError(t, err)
+	assert.Equal(t, "cora@monax.io", changed.Email)
+
+	confirmation := test.GetEmail(t, emailClient)
+	assert.Equal(t, "email-changed", confirmation.TemplateID)
+	assert.Equal(t, []string{"cora@monax.io"}, emailing.ToAddresses(confirmation),
+		"the confirmation goes to the new address")
+	assert.Equal(t, "cora@monax.io", emailing.TemplateData(confirmation)["email"])
+}
+
+func TestPostEmailRevertCancelsPendingChange(t *testing.T) {
+	app := test.App()
+	app.TokenRedemptions = redemption.NewMemoryStore()
+	app.Config.Email.TokenOnlyEmailChange = true
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	email := "okhuoh@co.co"
+	user := test.CreateUser(t, app, "MR FROG THE SEVENTH", "thisisapassword", email)
+	verify, err := emailverify.New(app.Config, "attacker@co.co")
+	require.NoError(t, err)
+	verifyToken, err := verify.WithAccountID(user.AccountID).WithStamp(user.Email, user.PasswordChangedAt, false).
+		Sign(tokens.Keyring(app.Config))
+	require.NoError(t, err)
+	revert, err := emailrevert.New(app.Config, user.AccountID, email, "attacker@co.co")
+	require.NoError(t, err)
+	revertToken, err := revert.Sign(tokens.Keyring(app.Config))
+	require.NoError(t, err)
+
+	// The owner reverts from the notice before whoever requested the change has completed it
+	client := test.NewClient(app, srv.URL)
+	resp, err := client.PostForm("/email/revert", url.Values{"token": []string{revertToken}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = client.PostForm("/email/verify/complete", url.Values{"token": []string{verifyToken}})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "token", kservices.ErrInvalidOrExpired)
+	unchanged, err := app.UserStore.FindUserByAccountID(user.AccountID)
+	require.NoError(t, err)
+	assert.Equal(t, email, unchanged.Email)
 }
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/models"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// swagger:parameters loginEmail
+type LoginEmailArgs struct {
+	// in: formData
+	// required: true
+	Email string `json:"email"`
+	// Optional BCP 47 language tag for emails sent, defaults to the Accept-Language header
+	// in: formData
+	Locale string `json:"locale"`
+}
+
+// PostLoginEmail swagger:route POST /login/email loginEmail
+// Send a link to log in without a password to the address of an account.
+// The response is the same whether or not an account has the address.
+// Consumes:
+// - application/x-www-form-urlencoded
+// Responses:
+//   422: fieldErrors
+func PostLoginEmail(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic(err)
+		}
+
+		args := new(LoginEmailArgs)
+		if err = Decode(r.Form, args); !HandleError(w, err) {
+			return
+		}
+
+		err = app.Dispatchers.LoginEmail(args.Email, RequestMailContext(r, args.Locale))
+		if err != nil {
+			panic(err)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (args *LoginEmailArgs) Validate() error {
+	err := validation.ValidateStruct(args,
+		validation.Field(&args.Email, validation.Required, validation.Length(1, models.MaximumNameEmailLength)),
+		validation.Field(&args.Locale, isLocale))
+	if err != nil {
+		return err
+	}
+	return normalizeEmail("email", &args.Email)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/services"
+	validation "github.com/go-ozzo/ozzo-validation"
+	kservices "github.com/keratin/authn-server/app/services"
+	"github.com/keratin/authn-server/lib/route"
+	"github.com/keratin/authn-server/server/handlers"
+	"github.com/keratin/authn-server/server/sessions"
+)
+
+// swagger:parameters completeLoginEmail
+type LoginEmailCompleteArgs struct {
+	// The token from the link sent by /login/email
+	// in: formData
+	// required: true
+	Token string `json:"token"`
+}
+
+// PostLoginEmailComplete swagger:route POST /login/email/complete completeLoginEmail
+// Log in with the token sent by /login/email. Responds as keratin's POST /session does, with the session in a cookie
+// and the identity token in the body.
+// Consumes:
+// - application/x-www-form-urlencoded
+// Responses:
+//   201: idToken
+//   422: fieldErrors
+func PostLoginEmailComplete(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic(err)
+		}
+
+		args := new(LoginEmailCompleteArgs)
+		if err = Decode(r.Form, args); !HandleError(w, err) {
+			return
+		}
+
+		accountID, err := services.LoginTokenVerifier(app.AccountStore, app.TokenRedemptions, app.Config, args.Token)
+		if !HandleError(w, err) {
+			return
+		}
+
+		sessionToken, identityToken, err := kservices.SessionCreator(app.AccountStore, app.RefreshTokenStore,
+			app.KeyStore, app.Actives, app.Config.Keratin(), app.Reporter, accountID, route.MatchedDomain(r),
+			sessions.GetRefreshToken(r))
+		if err != nil {
+			panic(err)
+		}
+
+		sessions.Set(app.Config.Keratin(), w, sessionToken)
+		handlers.WriteData(w, http.StatusCreated, IDTokenResult{IDToken: identityToken})
+	}
+}
+
+func (args *LoginEmailCompleteArgs) Validate() error {
+	return validation.ValidateStruct(args,
+		validation.Field(&args.Token, validation.Required))
+}
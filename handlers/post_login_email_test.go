@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/test"
+	"code.monax.io/monax/pericyte/test/mock"
+	"code.monax.io/monax/pericyte/tokens/redemption"
+	kservices "github.com/keratin/authn-server/app/services"
+	"github.com/keratin/authn-server/lib/route"
+	"github.com/test-go/testify/assert"
+	"github.com/test-go/testify/require"
+)
+
+func TestPostLoginEmail(t *testing.T) {
+	app := test.App()
+	app.TokenRedemptions = redemption.NewMemoryStore()
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	email := "foo@bar.net"
+	test.CreateUser(t, app, "test_user", "dsf9u948hr8734ge8", email)
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+	for _, address := range []string{"nobody@bar.net", email} {
+		resp, err := client.PostForm("/login/email", url.Values{"email": []string{address}})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, "the response does not depend on the account existing")
+	}
+
+	// Nothing is sent for the unknown address
+	loginEmail := test.GetEmail(t, emailClient)
+	assert.Equal(t, []string{email}, emailing.ToAddresses(loginEmail))
+	token := test.GetTokenFromEmail(t, loginEmail)
+
+	resp, err := client.PostForm("/login/email/complete", url.Values{"token": []string{"not-a-token"}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp, err = client.PostForm("/login/email/complete", url.Values{"token": []string{token}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var session *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == app.Config.SessionCookieName {
+			session = c
+		}
+	}
+	assert.NotNil(t, session, "a session is established")
+
+	resp, err = client.PostForm("/login/email/complete", url.Values{"token": []string{token}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, "the token can only be used once")
+}
+
+func TestPostLoginEmailCompleteRequireNewPassword(t *testing.T) {
+	app := test.App()
+	app.TokenRedemptions = redemption.NewMemoryStore()
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	email := "foo@bar.net"
+	user := test.CreateUser(t, app, "test_user", "dsf9u948hr8734ge8", email)
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+	resp, err := client.PostForm("/login/email", url.Values{"email": []string{email}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	token := test.GetTokenFromEmail(t, test.GetEmail(t, emailClient))
+
+	_, err = app.AccountStore.RequireNewPassword(user.AccountID)
+	require.NoError(t, err)
+
+	resp, err = client.PostForm("/login/email/complete", url.Values{"token": []string{token}})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "credentials", kservices.ErrExpired)
+}
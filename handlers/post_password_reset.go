@@ -13,10 +13,14 @@ type PasswordResetArgs struct {
 	// in: formData
 	// required: true
 	Email string
+	// Optional BCP 47 language tag for emails sent, defaults to the Accept-Language header
+	// in: formData
+	Locale string
 }
 
 // PostPasswordReset swagger:route POST /password/reset resetPassword
 // Issue pericyte password reset for account.
+// The response is the same whether or not an account has the address.
 // Consumes:
 // - application/x-www-form-urlencoded
 // Responses:
@@ -33,7 +37,7 @@ func PostPasswordReset(app *pericyte.App) http.HandlerFunc {
 			return
 		}
 
-		err = app.Dispatchers.PasswordResetEmail(args.Email)
+		err = app.Dispatchers.PasswordResetEmail(args.Email, RequestMailContext(r, args.Locale))
 		if err != nil {
 			panic(err)
 		}
@@ -43,7 +47,12 @@ func PostPasswordReset(app *pericyte.App) http.HandlerFunc {
 }
 
 func (args *PasswordResetArgs) Validate() error {
-	return validation.ValidateStruct(args,
+	err := validation.ValidateStruct(args,
 		validation.Field(&args.Email, validation.Required, validation.Length(1, models.MaximumNameEmailLength)),
+		validation.Field(&args.Locale, isLocale),
 	)
+	if err != nil {
+		return err
+	}
+	return normalizeEmail("email", &args.Email)
 }
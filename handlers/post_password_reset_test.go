@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"testing"
 
+	"code.monax.io/monax/pericyte/emailing"
 	"code.monax.io/monax/pericyte/services"
 	"code.monax.io/monax/pericyte/test"
 	"code.monax.io/monax/pericyte/test/mock"
@@ -46,3 +47,23 @@ func TestPostPasswordReset(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, account.ID, accountID)
 }
+
+func TestPostPasswordResetUnknown(t *testing.T) {
+	app := test.App()
+	app.Config.Email.TemplatesIDs.PasswordResetUnknown = "reset-unknown"
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+	resp, err := client.PostForm("/password/reset", url.Values{
+		"email": []string{"nobody@bar.net"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	email := test.GetEmail(t, emailClient)
+	assert.Equal(t, "reset-unknown", email.TemplateID)
+	assert.Equal(t, []string{"nobody@bar.net"}, emailing.ToAddresses(email))
+}
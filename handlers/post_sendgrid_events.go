@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/emailing"
+)
+
+// SendGrid batches events so allow a generous request size
+const maxEventsPayloadSize = 10 << 20
+
+// PostSendgridEvents swagger:route POST /email/events/sendgrid sendgridEvents
+// Receives SendGrid Signed Event Webhook deliveries and records delivery events for messages we sent.
+// Hard bounces and spam reports add the recipient to the suppression list.
+// Provider message IDs are recorded against archived messages.
+// Requests not signed with the configured verification key are rejected.
+// Consumes:
+// - application/json
+// Responses:
+//   200:
+//   401:
+func PostSendgridEvents(app *pericyte.App) http.HandlerFunc {
+	logger := app.Logger.WithField("scope", "PostSendgridEvents")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.EmailWebhook == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEventsPayloadSize))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err = app.EmailWebhook.Verify(payload, r.Header.Get(emailing.WebhookSignatureHeader),
+			r.Header.Get(emailing.WebhookTimestampHeader))
+		if err != nil {
+			logger.WithError(err).Warn("rejecting event webhook request")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		events, err := emailing.ParseSendgridEvents(payload)
+		if err != nil {
+			logger.WithError(err).Warn("could not parse event webhook request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err = app.EmailEvents.AddEvents(events...)
+		if err != nil {
+			panic(err)
+		}
+
+		err = emailing.SuppressFromEvents(app.EmailSuppressions, events)
+		if err != nil {
+			panic(err)
+		}
+
+		if app.EmailArchive != nil {
+			err = emailing.ArchiveFromEvents(app.EmailArchive, events)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/test"
+	"code.monax.io/monax/pericyte/test/mock"
+	"github.com/keratin/authn-server/lib/route"
+	"github.com/test-go/testify/assert"
+	"github.com/test-go/testify/require"
+)
+
+func TestPostSendgridEvents(t *testing.T) {
+	app := test.App()
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	app.EmailEvents = emailing.NewMemoryEventStore()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	app.EmailWebhook, err = emailing.NewWebhookVerifier(base64.StdEncoding.EncodeToString(der), 0)
+	require.NoError(t, err)
+
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+	resp, err := client.PostForm("/signup", url.Values{"email": []string{"cora@monax.io"}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	tracking := emailing.MessageTracking(test.GetEmail(t, emailClient))
+	require.NotEmpty(t, tracking.MessageID)
+
+	payload, err := json.Marshal([]map[string]interface{}{
+		{
+			"email":               "cora@monax.io",
+			"timestamp":           time.Now().Unix(),
+			"event":               "delivered",
+			"sg_event_id":         "event-1",
+			"sg_message_id":       "sg-message-1",
+			emailing.MessageIDArg: tracking.MessageID,
+			emailing.TaskArg:      tracking.Task,
+			emailing.JobIDArg:     tracking.JobID,
+		},
+		{
+			"email":       "someone@else.com",
+			"timestamp":   time.Now().Unix(),
+			"event":       "delivered",
+			"sg_event_id": "event-2",
+		},
+	})
+	require.NoError(t, err)
+
+	post := func(signature string, timestamp string) *http.Response {
+		if timestamp == "" {
+			timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+		}
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/email/events/sendgrid", bytes.NewReader(payload))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(emailing.WebhookTimestampHeader, timestamp)
+		if signature == "" {
+			signature = sign(t, key, timestamp, payload)
+		}
+		req.Header.Set(emailing.WebhookSignatureHeader, signature)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("rejects unsigned events", func(t *testing.T) {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		resp := post(sign(t, otherKey, "0", payload), "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("rejects replayed events", func(t *testing.T) {
+		resp := post("", strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("records events against the message sent", func(t *testing.T) {
+		resp := post("", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		// Repeated deliveries are idempotent
+		resp = post("", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		events, err := app.EmailEvents.FindEventsByMessageID(tracking.MessageID)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, emailing.Delivered, events[0].Type)
+		assert.Equal(t, "SignupEmail", events[0].Task)
+		assert.Equal(t, tracking.JobID, events[0].JobID)
+		assert.Equal(t, "sg-message-1", events[0].ProviderMessageID)
+	})
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, timestamp string, payload []byte) string {
+	digest := sha256.Sum256(append([]byte(timestamp), payload...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(sig)
+}
@@ -4,7 +4,9 @@ import (
 	"net/http"
 
 	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/emailaddress"
 	"code.monax.io/monax/pericyte/models"
+	"code.monax.io/monax/pericyte/services"
 	validation "github.com/go-ozzo/ozzo-validation"
 )
 
@@ -13,6 +15,14 @@ type SignupArgs struct {
 	// in: formData
 	// required: true
 	Email string `json:"email"`
+	// Optional BCP 47 language tag for emails sent, defaults to the Accept-Language header
+	// in: formData
+	Locale string `json:"locale"`
+	// Set once the user has confirmed their address is correct despite a suggested correction
+	// in: formData
+	ConfirmEmail bool `json:"confirm_email" schema:"confirm_email"`
+	// Set by the handler, schema ignores unexported fields
+	checker *emailaddress.Checker
 }
 
 // PostSignup swagger:route POST /signup signupAs
@@ -27,12 +37,16 @@ func PostSignup(app *pericyte.App) http.HandlerFunc {
 		if err = r.ParseForm(); err != nil {
 			panic(err)
 		}
-		args := new(SignupArgs)
+		args := &SignupArgs{checker: app.EmailChecker}
 		if err = Decode(r.Form, args); !HandleError(w, err) {
 			return
 		}
+		err = services.SuppressionChecker(app.EmailSuppressions, "email", args.Email)
+		if !HandleError(w, err) {
+			return
+		}
 
-		err = app.Dispatchers.SignupEmail(args.Email)
+		err = app.Dispatchers.SignupEmail(args.Email, RequestMailContext(r, args.Locale))
 		if err != nil {
 			panic(err)
 		}
@@ -40,6 +54,20 @@ func PostSignup(app *pericyte.App) http.HandlerFunc {
 }
 
 func (args *SignupArgs) Validate() error {
-	return validation.ValidateStruct(args,
-		validation.Field(&args.Email, validation.Required, validation.Length(1, models.MaximumNameEmailLength)))
+	err := validation.ValidateStruct(args,
+		validation.Field(&args.Email, validation.Required, validation.Length(1, models.MaximumNameEmailLength)),
+		validation.Field(&args.Locale, isLocale))
+	if err != nil {
+		return err
+	}
+	err = normalizeEmail("email", &args.Email)
+	if err != nil || args.checker == nil {
+		return err
+	}
+	err = args.checker.Check(args.Email, args.ConfirmEmail)
+	if _, ok := err.(*emailaddress.QualityError); ok {
+		return validation.Errors{"email": err}
+	}
+	// Fail open when DNS cannot be checked rather than blocking signups
+	return nil
 }
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.monax.io/monax/pericyte"
+	"code.monax.io/monax/pericyte/services"
+	validation "github.com/go-ozzo/ozzo-validation"
+	kservices "github.com/keratin/authn-server/app/services"
+	"github.com/keratin/authn-server/lib/route"
+	"github.com/keratin/authn-server/server/handlers"
+	"github.com/keratin/authn-server/server/sessions"
+)
+
+// swagger:parameters completeSignup
+type SignupCompleteArgs struct {
+	// The token from the link sent by /signup
+	// in: formData
+	// required: true
+	Token string `json:"token"`
+	// in: formData
+	// required: true
+	Username string `json:"username"`
+	// in: formData
+	// required: true
+	Password string `json:"password"`
+}
+
+// PostSignupComplete swagger:route POST /signup/complete completeSignup
+// Create an account for the address verified by a signup token and log in to it. Responds as keratin's
+// POST /accounts does, with the session in a cookie and the identity token in the body.
+// Consumes:
+// - application/x-www-form-urlencoded
+// Responses:
+//   201: idToken
+//   422: fieldErrors
+func PostSignupComplete(app *pericyte.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic(err)
+		}
+
+		args := new(SignupCompleteArgs)
+		if err = Decode(r.Form, args); !HandleError(w, err) {
+			return
+		}
+
+		_, account, err := services.SignupCompleter(app.UserStore, app.TokenRedemptions, app.Config, app.Logger,
+			args.Token, args.Username, args.Password)
+		if !HandleError(w, err) {
+			return
+		}
+
+		sessionToken, identityToken, err := kservices.SessionCreator(app.AccountStore, app.RefreshTokenStore,
+			app.KeyStore, app.Actives, app.Config.Keratin(), app.Reporter, account.ID, route.MatchedDomain(r),
+			sessions.GetRefreshToken(r))
+		if err != nil {
+			panic(err)
+		}
+
+		sessions.Set(app.Config.Keratin(), w, sessionToken)
+		handlers.WriteData(w, http.StatusCreated, IDTokenResult{IDToken: identityToken})
+	}
+}
+
+// swagger:response idToken
+type IDTokenResult struct {
+	// in: body
+	IDToken string `json:"id_token"`
+}
+
+func (args *SignupCompleteArgs) Validate() error {
+	return validation.ValidateStruct(args,
+		validation.Field(&args.Token, validation.Required),
+		validation.Field(&args.Username, validation.Required),
+		validation.Field(&args.Password, validation.Required))
+}
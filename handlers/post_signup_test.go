@@ -1,14 +1,24 @@
 package handlers_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"testing"
 
+	"code.monax.io/monax/pericyte/emailaddress"
+	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/handlers"
 	"code.monax.io/monax/pericyte/services"
 	"code.monax.io/monax/pericyte/test"
 	"code.monax.io/monax/pericyte/test/mock"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/emailverify"
+	"code.monax.io/monax/pericyte/tokens/redemption"
+	kservices "github.com/keratin/authn-server/app/services"
 	"github.com/keratin/authn-server/lib/route"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/test-go/testify/assert"
 	"github.com/test-go/testify/require"
 )
@@ -34,3 +44,250 @@ func TestPostSignup(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, email, verifiedEmail)
 }
+
+func TestPostSignupLocalized(t *testing.T) {
+	app := test.App()
+	app.Config.Email.LocalizedTemplates = map[string]emailing.Templates{
+		"fr": {emailing.PurposeSignup: "signup-fr"},
+	}
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+
+	resp, err := client.PostForm("/signup", url.Values{
+		"email":  []string{"elodie@monax.io"},
+		"locale": []string{"fr-CA"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	email := test.GetEmail(t, emailClient)
+	assert.Equal(t, "signup-fr", email.TemplateID)
+	claims, err := emailverify.Parse(test.GetTokenFromEmail(t, email), app.Config)
+	require.NoError(t, err)
+	assert.Equal(t, "fr-CA", claims.Locale)
+}
+
+func TestPostSignupSuppressed(t *testing.T) {
+	app := test.App()
+	app.EmailSuppressions = emailing.NewMemorySuppressionStore()
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	email := "bounced@monax.io"
+	err := app.EmailSuppressions.Suppress(&emailing.Suppression{Email: email, Reason: emailing.SuppressedBounce})
+	require.NoError(t, err)
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+	resp, err := client.PostForm("/signup", url.Values{
+		"email": []string{email},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func TestPostSignupNormalizesEmail(t *testing.T) {
+	app := test.App()
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+	resp, err := client.PostForm("/signup", url.Values{
+		"email": []string{" Cora@Bücher.Example "},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	email := test.GetEmail(t, emailClient)
+	assert.Equal(t, []string{"Cora@xn--bcher-kva.example"}, emailing.ToAddresses(email))
+
+	resp, err = client.PostForm("/signup", url.Values{
+		"email": []string{"cora@monax"},
+	})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "email", kservices.ErrFormatInvalid)
+}
+
+func TestPostSignupAddressChecks(t *testing.T) {
+	app := test.App()
+	app.EmailChecker = emailaddress.NewChecker(&emailaddress.CheckerConfig{
+		BlockDisposable: true,
+		SuggestTypos:    true,
+	}, nil)
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+	resp, err := client.PostForm("/signup", url.Values{"email": []string{"cora@mailinator.com"}})
+	require.NoError(t, err)
+	assertFieldError(t, resp, "email", "DISPOSABLE")
+
+	resp, err = client.PostForm("/signup", url.Values{"email": []string{"cora@gmial.com"}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var body handlers.ServiceErrors
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	assert.Equal(t, kservices.FieldErrors{{Field: "email", Message: "TYPO"}}, body.Errors)
+	assert.Equal(t, map[string]string{"email": "cora@gmail.com"}, body.Suggestions)
+
+	resp, err = client.PostForm("/signup", url.Values{
+		"email":         []string{"cora@gmial.com"},
+		"confirm_email": []string{"true"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestPostSignupBranded(t *testing.T) {
+	app := test.App()
+	domain := &app.Config.ApplicationDomains[0]
+	app.Config.Email.Brands = map[string]*emailing.Brand{
+		domain.String(): {
+			From:      mail.NewEmail("Brand", "hello@brand.example"),
+			Templates: emailing.Templates{emailing.PurposeSignup: "signup-brand"},
+			Links:     &emailing.Links{CompleteSignup: "https://brand.example/app/signup?ref=email"},
+		},
+	}
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	client := route.NewClient(srv.URL).Referred(domain)
+	resp, err := client.PostForm("/signup", url.Values{
+		"email": []string{"cora@monax.io"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	email := test.GetEmail(t, emailClient)
+	assert.Equal(t, "signup-brand", email.TemplateID)
+	assert.Equal(t, "hello@brand.example", email.From.Address)
+	data := emailing.TemplateData(email)
+	token := data["token"].(string)
+	assert.Equal(t, "https://brand.example/app/signup?ref=email&token="+url.QueryEscape(token),
+		data["token_link"])
+}
+
+func TestPostSignupComplete(t *testing.T) {
+	app := test.App()
+	app.TokenRedemptions = redemption.NewMemoryStore()
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	email := "cora@monax.io"
+	claims, err := emailverify.New(app.Config, email)
+	require.NoError(t, err)
+	token, err := claims.WithLocale("fr-CA").Sign(tokens.Keyring(app.Config))
+	require.NoError(t, err)
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+	resp, err := client.PostForm("/signup/complete", url.Values{
+		"token":    []string{"not-a-token"},
+		"username": []string{"cora"},
+		"password": []string{"dsf9u948hr8734ge8"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp, err = client.PostForm("/signup/complete", url.Values{
+		"token":    []string{token},
+		"username": []string{"cora"},
+		"password": []string{"dsf9u948hr8734ge8"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	defer resp.Body.Close()
+
+	var body struct {
+		Result handlers.IDTokenResult `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.NotEmpty(t, body.Result.IDToken)
+	var session *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == app.Config.SessionCookieName {
+			session = c
+		}
+	}
+	assert.NotNil(t, session, "a session is established")
+
+	user, err := app.UserStore.FindUserByEmail(email)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, "fr-CA", user.Locale)
+
+	resp, err = client.PostForm("/signup/complete", url.Values{
+		"token":    []string{token},
+		"username": []string{"cora2"},
+		"password": []string{"dsf9u948hr8734ge8"},
+	})
+	require.NoError(t, err)
+	// Rejected for the token rather than the address now being taken
+	assertFieldError(t, resp, "token", kservices.ErrInvalidOrExpired)
+}
+
+// assertFieldError checks that resp is a 422 reporting message against field
+func assertFieldError(t *testing.T, resp *http.Response, field, message string) {
+	t.Helper()
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var body handlers.ServiceErrors
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Contains(t, body.Errors, kservices.FieldError{Field: field, Message: message})
+}
+
+func TestPostSignupCompleteDeduplicatesAddresses(t *testing.T) {
+	app := test.App()
+	app.TokenRedemptions = redemption.NewMemoryStore()
+	app.Config.Email.AddressPolicy = &emailaddress.Policy{PlusAddressing: []string{"gmail.com"}}
+	app.Config.Email.TemplatesIDs.AlreadyRegistered = "already-registered"
+	emailClient := mock.NewEmailClient()
+	test.WithEmailClient(app, emailClient.Sender())
+	srv := test.NewServer(app)
+	defer srv.Close()
+
+	client := route.NewClient(srv.URL).Referred(&app.Config.ApplicationDomains[0])
+	complete := func(email, username string) *http.Response {
+		claims, err := emailverify.New(app.Config, email)
+		require.NoError(t, err)
+		token, err := claims.Sign(tokens.Keyring(app.Config))
+		require.NoError(t, err)
+		resp, err := client.PostForm("/signup/complete", url.Values{
+			"token":    []string{token},
+			"username": []string{username},
+			"password": []string{"dsf9u948hr8734ge8"},
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	for i, tc := range []struct {
+		first, second string
+	}{
+		{"Alice@monax.io", "alice@monax.io"},
+		{"bob@monax.io", "Bob@monax.io"},
+		{"cora+news@gmail.com", "cora@gmail.com"},
+		{"dave@gmail.com", "dave+news@gmail.com"},
+	} {
+		resp := complete(tc.first, fmt.Sprintf("first%d", i))
+		require.Equal(t, http.StatusCreated, resp.StatusCode, tc.first)
+		resp.Body.Close()
+
+		assertFieldError(t, complete(tc.second, fmt.Sprintf("second%d", i)), "email", kservices.ErrTaken)
+
+		resp, err := client.PostForm("/signup", url.Values{"email": []string{tc.second}})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "already-registered", test.GetEmail(t, emailClient).TemplateID,
+			"%s is registered as %s", tc.second, tc.first)
+	}
+}
@@ -14,5 +14,7 @@ type InputArgs interface {
 type ServiceErrors struct {
 	// in: body
 	Errors services.FieldErrors `json:"errors"`
+	// Corrected addresses for fields with a TYPO error, keyed by field
+	Suggestions map[string]string `json:"suggestions,omitempty"`
 }
 
@@ -0,0 +1,53 @@
+package pericyte
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/services"
+)
+
+// RunPreview implements the 'preview' subcommand, writing the rendering of the template configured for a purpose to
+// out as JSON. It renders through the configured sender's rendering path but does not need the rest of the app.
+// Usage: preview [-locale tag] [-domain domain] [-to address] [-data json] <purpose>
+func RunPreview(cfg *config.Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("preview", flag.ContinueOnError)
+	flags.SetOutput(out)
+	locale := flags.String("locale", "", "BCP 47 language tag selecting a localised template")
+	domain := flags.String("domain", "", "application domain selecting a brand")
+	to := flags.String("to", "", "recipient address")
+	data := flags.String("data", "", "JSON object of template variables overriding the sample values")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("preview takes exactly one purpose, e.g. 'Signup' or 'PasswordResetExpired'")
+	}
+
+	var params map[string]interface{}
+	if *data != "" {
+		err = json.Unmarshal([]byte(*data), &params)
+		if err != nil {
+			return fmt.Errorf("could not parse -data as a JSON object: %v", err)
+		}
+	}
+
+	renderer, err := emailing.NewRenderer(cfg.Email.SenderType, cfg.Email.SMTP)
+	if err != nil {
+		return err
+	}
+	mc := services.MailContext{Locale: *locale, Domain: *domain}
+	preview, err := services.EmailPreviewer(cfg, renderer, emailing.Purpose(flags.Arg(0)), mc, *to, params)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(preview)
+}
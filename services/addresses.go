@@ -0,0 +1,31 @@
+package services
+
+import (
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/data"
+	"code.monax.io/monax/pericyte/models"
+)
+
+// addressKey returns the canonical key of a normalized address, see emailaddress.Policy.Key. Accounts are stored under
+// their key so that each mailbox has at most one account, whichever variant of its address is given. The policy only
+// folds variants the provider delivers to the same mailbox, so the key is also where mail is sent.
+func addressKey(cfg *config.Config, email string) string {
+	return cfg.Email.AddressPolicy.Key(email)
+}
+
+// findUserByAddress returns the account for a normalized address, or nil if there is none. Accounts are looked up by
+// the key of the address. Accounts stored before addresses were keyed are stored as given so are matched by the
+// address itself when no account has the key.
+func findUserByAddress(store data.UserStore, cfg *config.Config, email string) (*models.UserAccount, error) {
+	key := addressKey(cfg, email)
+	user, err := store.FindUserByEmail(key)
+	if err != nil || user != nil || key == email {
+		return user, err
+	}
+	return store.FindUserByEmail(email)
+}
+
+// sameAddress returns whether two normalized addresses reach the same mailbox
+func sameAddress(cfg *config.Config, a, b string) bool {
+	return addressKey(cfg, a) == addressKey(cfg, b)
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/emailing"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// brand returns the brand configured for the application domain in mc or nil if the defaults apply
+func brand(cfg *config.Config, mc MailContext) *emailing.Brand {
+	if mc.Domain == "" {
+		return nil
+	}
+	return cfg.Email.Brands[mc.Domain]
+}
+
+// fromAddress returns the sender identity for the application domain in mc
+func fromAddress(cfg *config.Config, mc MailContext) *mail.Email {
+	if b := brand(cfg, mc); b != nil && b.From != nil {
+		return b.From
+	}
+	return &cfg.Email.From
+}
+
+// attachments returns the attachments configured for messages of purpose for the application domain in mc, followed
+// by those of the job
+func attachments(cfg *config.Config, purpose emailing.Purpose, mc MailContext) []*emailing.Attachment {
+	configured := cfg.Email.Attachments[purpose]
+	if b := brand(cfg, mc); b != nil {
+		if as, ok := b.Attachments[purpose]; ok {
+			configured = as
+		}
+	}
+	return append(append([]*emailing.Attachment(nil), configured...), mc.Attachments...)
+}
+
+// tokenLink returns the link carrying token to the front end page for messages of purpose, on the front end of the
+// brand for mc where it sets the page
+func tokenLink(cfg *config.Config, mc MailContext, purpose emailing.Purpose, token string) string {
+	if b := brand(cfg, mc); b != nil && b.Links != nil {
+		if link, ok := b.Links.Link(purpose, token); ok {
+			return link
+		}
+	}
+	switch purpose {
+	case emailing.PurposeSignup:
+		return cfg.Front.CompleteSignupURL(token)
+	case emailing.PurposePasswordReset, emailing.PurposePasswordResetNewUser, emailing.PurposePasswordResetExpired:
+		return cfg.Front.PasswordResetURL(token)
+	case emailing.PurposeVerifyEmail:
+		return cfg.Front.VerifyEmailURL(token)
+	case emailing.PurposeEmailChangeNotice:
+		return cfg.Front.RevertEmailURL(token)
+	case emailing.PurposeLogin:
+		return cfg.Front.LoginURL(token)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/data"
+	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/emailrevert"
+	"code.monax.io/monax/pericyte/tokens/redemption"
+	"code.monax.io/monax/pericyte/workers"
+	kdata "github.com/keratin/authn-server/app/data"
+	"github.com/keratin/authn-server/app/services"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// EmailChangeCompleter changes the email of the account a verify token was issued for to the address it verifies.
+// The token must be for the account logged in with sessionAccountID, which may only be zero when
+// cfg.Email.TokenOnlyEmailChange allows changes without a session. Returns the account ID and new address.
+func EmailChangeCompleter(store data.UserStore, redemptions redemption.Store, cfg *config.Config,
+	sessionAccountID int, token string) (int, string, error) {
+	claims, user, err := parseEmailChangeToken(store, cfg, token)
+	if err != nil {
+		return 0, "", err
+	}
+	accountID, email := claims.AccountID, claims.Subject
+	tokenOnly := sessionAccountID == 0 && cfg.Email.TokenOnlyEmailChange
+	if accountID != sessionAccountID && !tokenOnly {
+		return 0, "", services.FieldErrors{{Field: "token", Message: services.ErrInvalidOrExpired}}
+	}
+
+	existing, err := findUserByAddress(store, cfg, email)
+	if err != nil {
+		return 0, "", err
+	}
+	if existing != nil && existing.AccountID != accountID {
+		return 0, "", services.FieldErrors{{Field: "email", Message: services.ErrTaken}}
+	}
+	err = redeemToken(redemptions, &claims.Claims)
+	if err != nil {
+		return 0, "", err
+	}
+	err = EmailUpdater(store, user.ID, addressKey(cfg, email))
+	if err != nil {
+		return 0, "", releaseToken(redemptions, &claims.Claims, err)
+	}
+	return accountID, email, nil
+}
+
+// EmailChangedDispatcher confirms to the new address of an account that the change of email is complete
+func EmailChangedDispatcher(args *DispatcherArgs) func(accountID int, email string, mc MailContext) error {
+	logger := args.Logger.WithFields(logrus.Fields{"scope": "EmailChangedDispatcher"})
+	cfg := args.Config
+
+	dispatcher := workers.NewDispatcher(args.Queue, args.Params, emailChangedTask,
+		func(ctx context.Context, accountID int, email string, mc MailContext) error {
+			log := logger.WithField("account_id", accountID)
+			if templateID(cfg, emailing.PurposeEmailChanged, mc) == "" {
+				log.Warn("no email changed template configured - not confirming change")
+				return nil
+			}
+			user, err := args.UserStore.FindUserByAccountID(accountID)
+			if err != nil {
+				return err
+			}
+			if user == nil {
+				return fmt.Errorf("EmailChanged: could not find account with ID %v", accountID)
+			}
+
+			mc.Locale = preferredLocale(user.Locale, mc.Locale)
+			err = sendEmail(args, emailChangedTask, accountID, mc, email, &EmailChangedParams{Email: email})
+			if err != nil {
+				return fmt.Errorf("could not send email changed email to %s: %w", email, err)
+			}
+			log.Info("email changed email sent")
+			return nil
+		}, args.ErrorReporter)
+
+	return func(accountID int, email string, mc MailContext) error {
+		return dispatcher(accountID, email, mc.dispatched(args.Params, emailChangedTask, accountID, email))
+	}
+}
+
+// EmailReverter restores the email of the account a revert token was issued for to the address it had before the
+// change was requested. Whoever requested the change had access to the account so its password is expired, ending
+// its sessions and invalidating any pending email change, and the user must reset it through the restored address.
+// The account must still have either address; once it has moved on to another the token no longer describes its
+// history.
+func EmailReverter(store data.UserStore, accountStore kdata.AccountStore, refreshTokenStore kdata.RefreshTokenStore,
+	redemptions redemption.Store, cfg *config.Config, token string) (int, error) {
+	invalid := services.FieldErrors{{Field: "token", Message: services.ErrInvalidOrExpired}}
+	claims, err := emailrevert.Parse(token, cfg)
+	if err != nil {
+		return 0, invalid
+	}
+	user, err := store.FindUserByAccountID(claims.AccountID)
+	if err != nil {
+		return 0, err
+	}
+	if user == nil {
+		return 0, services.FieldErrors{{Field: "user", Message: services.ErrNotFound}}
+	}
+	reverted := sameAddress(cfg, user.Email, claims.Subject)
+	if !reverted && !sameAddress(cfg, user.Email, claims.NewEmail) {
+		return 0, invalid
+	}
+	if !reverted {
+		// The previous address is free to be taken by another account once the change is made
+		existing, err := findUserByAddress(store, cfg, claims.Subject)
+		if err != nil {
+			return 0, err
+		}
+		if existing != nil && existing.AccountID != claims.AccountID {
+			return 0, services.FieldErrors{{Field: "email", Message: services.ErrTaken}}
+		}
+	}
+	err = redeemToken(redemptions, &claims.Claims)
+	if err != nil {
+		return 0, err
+	}
+	if !reverted {
+		err = EmailUpdater(store, user.ID, addressKey(cfg, claims.Subject))
+		if err != nil {
+			return 0, releaseToken(redemptions, &claims.Claims, err)
+		}
+	}
+	err = services.PasswordExpirer(accountStore, refreshTokenStore, claims.AccountID)
+	if err != nil {
+		return 0, errors.Wrap(err, "PasswordExpirer")
+	}
+	return claims.AccountID, nil
+}
+
+// emailChangeNoticeDispatcher tells the previous address of an account that a change of email was requested, with a
+// link to revert it. It is a job of its own so that failing to send the notice does not resend the verification.
+func emailChangeNoticeDispatcher(args *DispatcherArgs) func(accountID int, previousEmail, newEmail string,
+	mc MailContext) error {
+	logger := args.Logger.WithFields(logrus.Fields{"scope": "EmailChangeNoticeDispatcher"})
+	cfg := args.Config
+
+	dispatcher := workers.NewDispatcher(args.Queue, args.Params, emailChangeNoticeTask,
+		func(ctx context.Context, accountID int, previousEmail, newEmail string, mc MailContext) error {
+			log := logger.WithField("account_id", accountID)
+			if templateID(cfg, emailing.PurposeEmailChangeNotice, mc) == "" {
+				log.Warn("no email change notice template configured - not notifying previous address")
+				return nil
+			}
+
+			claims, err := emailrevert.New(cfg, accountID, previousEmail, newEmail)
+			if err != nil {
+				return errors.Wrap(err, "New Revert")
+			}
+			token, err := claims.Sign(tokens.Keyring(cfg))
+			if err != nil {
+				return errors.Wrap(err, "Sign")
+			}
+
+			err = sendEmail(args, emailChangeNoticeTask, accountID, mc, previousEmail, &EmailChangeNoticeParams{
+				TokenParams: TokenParams{
+					Token:     token,
+					TokenLink: tokenLink(cfg, mc, emailing.PurposeEmailChangeNotice, token),
+				},
+				NewEmail: newEmail,
+			})
+			if err != nil {
+				return fmt.Errorf("could not send email change notice to %s: %w", previousEmail, err)
+			}
+			log.Info("email change notice sent")
+			return nil
+		}, args.ErrorReporter)
+
+	return func(accountID int, previousEmail, newEmail string, mc MailContext) error {
+		return dispatcher(accountID, previousEmail, newEmail,
+			mc.dispatched(args.Params, emailChangeNoticeTask, accountID, previousEmail, newEmail))
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/emaillogin"
+	"code.monax.io/monax/pericyte/tokens/redemption"
+	"code.monax.io/monax/pericyte/workers"
+	kdata "github.com/keratin/authn-server/app/data"
+	"github.com/keratin/authn-server/app/services"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// LoginTokenVerifier returns the account a login token is for, provided its password has not changed since the token
+// was issued, it has not been locked or archived and it is not waiting on a new password. An expired password must be
+// reset rather than bypassed with a login link.
+func LoginTokenVerifier(accountStore kdata.AccountStore, redemptions redemption.Store, cfg *config.Config,
+	token string) (int, error) {
+	invalid := services.FieldErrors{{Field: "token", Message: services.ErrInvalidOrExpired}}
+	claims, err := emaillogin.Parse(token, cfg)
+	if err != nil {
+		return 0, invalid
+	}
+	accountID, err := claims.AccountID()
+	if err != nil {
+		return 0, invalid
+	}
+	account, err := accountStore.Find(accountID)
+	if err != nil {
+		return 0, err
+	}
+	if account == nil || account.Archived() || claims.LockExpired(account.PasswordChangedAt) {
+		return 0, invalid
+	}
+	if account.Locked {
+		return 0, services.FieldErrors{{Field: "account", Message: services.ErrLocked}}
+	}
+	if account.RequireNewPassword {
+		return 0, services.FieldErrors{{Field: "credentials", Message: services.ErrExpired}}
+	}
+	err = redeemToken(redemptions, &claims.Claims)
+	if err != nil {
+		return 0, err
+	}
+	return accountID, nil
+}
+
+func LoginEmailDispatcher(args *DispatcherArgs) func(email string, mc MailContext) error {
+	logger := args.Logger.WithFields(logrus.Fields{"scope": "LoginEmailDispatcher"})
+	cfg := args.Config
+
+	dispatcher := workers.NewDispatcher(args.Queue, args.Params, loginEmailTask,
+		func(ctx context.Context, email string, mc MailContext) error {
+			log := logger.WithField("email", email)
+			user, err := findUserByAddress(args.UserStore, cfg, email)
+			if err != nil {
+				return err
+			}
+			if user == nil {
+				log.Info("no account for login email - ignoring")
+				return nil
+			}
+
+			log.Info("generating login email")
+			claims, err := emaillogin.New(cfg, user.AccountID, user.PasswordChangedAt)
+			if err != nil {
+				return errors.Wrap(err, "New Login")
+			}
+			token, err := claims.Sign(tokens.Keyring(cfg))
+			if err != nil {
+				return errors.Wrap(err, "Sign")
+			}
+
+			mc.Locale = preferredLocale(user.Locale, mc.Locale)
+			err = sendEmail(args, loginEmailTask, user.AccountID, mc, user.Email, &LoginParams{TokenParams{
+				Token:     token,
+				TokenLink: tokenLink(cfg, mc, emailing.PurposeLogin, token),
+			}})
+			if err != nil {
+				return fmt.Errorf("could not send login email to %s: %w", user.Email, err)
+			}
+			log.Info("login email sent")
+			return nil
+		}, args.ErrorReporter)
+
+	// As for password resets the account is only looked up by the job so that requests do not reveal whether it exists
+	return func(email string, mc MailContext) error {
+		return dispatcher(email, mc.dispatched(args.Params, loginEmailTask, email))
+	}
+}
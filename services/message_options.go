@@ -0,0 +1,40 @@
+package services
+
+import (
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/emailing"
+)
+
+// Task names for dispatchers, recorded against the messages they send
+const (
+	signupEmailTask        = "SignupEmail"
+	passwordResetEmailTask = "PasswordResetEmail"
+	verifyEmailTask        = "VerifyEmail"
+	emailChangeNoticeTask  = "EmailChangeNotice"
+	emailChangedTask       = "EmailChanged"
+	loginEmailTask         = "LoginEmail"
+)
+
+// sendEmail sends the template for the purpose of params, branded and localised as mc requires, on behalf of task
+func sendEmail(args *DispatcherArgs, task string, accountID int, mc MailContext, to string,
+	params emailing.TemplateParams) error {
+	cfg := args.Config
+	purpose := params.Purpose()
+	opts := messageOptions(cfg, purpose, task, accountID, mc.JobID)
+	if as := attachments(cfg, purpose, mc); len(as) > 0 {
+		opts = append(opts, emailing.WithAttachments(args.Attachments, cfg.Email.MaxAttachmentSize, as...))
+	}
+	return emailing.Send(args.EmailSender, templateID(cfg, purpose, mc), to, fromAddress(cfg, mc), params, opts...)
+}
+
+// messageOptions returns the options for a message of purpose sent by task: any settings configured for the purpose
+// and tracking so that delivery events can be traced back to it, applied last so that nothing overwrites it
+func messageOptions(cfg *config.Config, purpose emailing.Purpose, task string, accountID int,
+	jobID string) []emailing.Option {
+	tracking := emailing.NewTracking(task, purpose, accountID)
+	tracking.JobID = jobID
+	return []emailing.Option{
+		emailing.WithSettings(cfg.Email.TemplateSettings[purpose]),
+		emailing.WithTracking(tracking),
+	}
+}
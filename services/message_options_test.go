@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/emailing"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendEmailAttachments(t *testing.T) {
+	attachment := func(name string) *emailing.Attachment {
+		return &emailing.Attachment{Filename: name, ContentType: "text/plain", Content: []byte(name)}
+	}
+	cfg := &config.Config{Email: &config.Email{}}
+	cfg.Email.TemplatesIDs.AlreadyRegistered = "already-registered"
+	cfg.Email.TemplatesIDs.EmailChanged = "email-changed"
+	cfg.Email.Attachments = emailing.PurposeAttachments{
+		emailing.PurposeAlreadyRegistered: {attachment("logo.txt")},
+	}
+	cfg.Email.Brands = map[string]*emailing.Brand{
+		"brand.example": {Attachments: emailing.PurposeAttachments{
+			emailing.PurposeAlreadyRegistered: {attachment("brand-logo.txt")},
+		}},
+	}
+	var sent *mail.SGMailV3
+	args := &DispatcherArgs{Config: cfg, EmailSender: func(email *mail.SGMailV3) error {
+		sent = email
+		return nil
+	}}
+	send := func(mc MailContext, params emailing.TemplateParams) []string {
+		require.NoError(t, sendEmail(args, "Test", 0, mc, "cora@monax.io", params))
+		names := make([]string, len(sent.Attachments))
+		for i, a := range sent.Attachments {
+			names[i] = a.Filename
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"logo.txt"}, send(MailContext{}, &AlreadyRegisteredParams{}))
+	assert.Empty(t, send(MailContext{}, &EmailChangedParams{}), "attachments are only sent for their purpose")
+	assert.Equal(t, []string{"brand-logo.txt"}, send(MailContext{Domain: "brand.example"}, &AlreadyRegisteredParams{}))
+	assert.Equal(t, []string{"logo.txt", "invoice.txt"},
+		send(MailContext{Attachments: []*emailing.Attachment{attachment("invoice.txt")}}, &AlreadyRegisteredParams{}),
+		"the job's attachments follow those configured")
+	assert.Equal(t, []string{"invoice.txt"},
+		send(MailContext{Attachments: []*emailing.Attachment{attachment("invoice.txt")}}, &EmailChangedParams{}))
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"code.monax.io/monax/pericyte/config"
 	"code.monax.io/monax/pericyte/emailing"
 	"code.monax.io/monax/pericyte/workers"
 	"github.com/sirupsen/logrus"
@@ -13,20 +12,20 @@ import (
 	"github.com/pkg/errors"
 )
 
-func PasswordResetEmailDispatcher(args *DispatcherArgs) func(email string) error {
+func PasswordResetEmailDispatcher(args *DispatcherArgs) func(email string, mc MailContext) error {
 	logger := args.Logger.WithFields(logrus.Fields{"scope": "PasswordResetEmailDispatcher"})
 	cfg := args.Config
 
-	dispatcher := workers.NewDispatcher(args.Queue, args.Params, "PasswordResetEmail",
-		func(ctx context.Context, email string) error {
+	dispatcher := workers.NewDispatcher(args.Queue, args.Params, passwordResetEmailTask,
+		func(ctx context.Context, email string, mc MailContext) error {
 			log := logger.WithField("email", email)
 			log.Info("generating password reset email")
-			user, err := args.UserStore.FindUserByEmail(email)
+			user, err := findUserByAddress(args.UserStore, cfg, email)
 			if err != nil {
 				return err
 			}
 			if user == nil {
-				return fmt.Errorf("PasswordResetEmail: could not find account with email %s", email)
+				return passwordResetUnknown(args, mc, email, log)
 			}
 
 			// Generate reset token
@@ -39,26 +38,52 @@ func PasswordResetEmailDispatcher(args *DispatcherArgs) func(email string) error
 			if err != nil {
 				return errors.Wrap(err, "Sign")
 			}
-			var templateID string
+			if user.Locale == "" && mc.Locale != "" {
+				// Remember the locale so later emails to this account are consistent
+				_, err = args.UserStore.UpdateLocale(user.ID, mc.Locale)
+				if err != nil {
+					return errors.Wrap(err, "UpdateLocale")
+				}
+			}
+			tokenParams := TokenParams{
+				Token:     token,
+				TokenLink: tokenLink(cfg, mc, emailing.PurposePasswordReset, token),
+			}
+			var params emailing.TemplateParams = &PasswordResetParams{tokenParams}
 			switch {
 			case user.LastLoginAt == nil:
-				templateID = cfg.Email.TemplatesIDs.PasswordResetNewUser
+				params = &PasswordResetNewUserParams{tokenParams}
 			case user.RequireNewPassword:
-				templateID = cfg.Email.TemplatesIDs.PasswordResetExpired
-			default:
-				templateID = cfg.Email.TemplatesIDs.PasswordReset
+				params = &PasswordResetExpiredParams{tokenParams}
 			}
-			err = emailing.Send(args.EmailSender, templateID, user.Email, &cfg.Email.From,
-				config.TokenParam, token,
-				config.TokenLinkParam, cfg.Front.PasswordResetURL(token))
+			mc.Locale = preferredLocale(user.Locale, mc.Locale)
+			err = sendEmail(args, passwordResetEmailTask, user.AccountID, mc, user.Email, params)
 			if err != nil {
-				return fmt.Errorf("could not send password reset email to %s: %v", user.Email, err)
+				return fmt.Errorf("could not send password reset email to %s: %w", user.Email, err)
 			}
 			log.Info("password reset email sent")
 			return nil
 		}, args.ErrorReporter)
 
-	return func(email string) error {
-		return dispatcher(email)
+	// The account is only looked up by the job so that the request takes the same path and time whether or not it
+	// exists
+	return func(email string, mc MailContext) error {
+		return dispatcher(email, mc.dispatched(args.Params, passwordResetEmailTask, email))
+	}
+}
+
+// passwordResetUnknown ends a reset requested for an address with no account, sending a notice if a template is
+// configured for it and otherwise doing nothing. Failing to send the notice is reported but not retried, so that the
+// request ends the first time it runs.
+func passwordResetUnknown(args *DispatcherArgs, mc MailContext, email string, log logrus.FieldLogger) error {
+	if templateID(args.Config, emailing.PurposePasswordResetUnknown, mc) == "" {
+		log.Info("no account for password reset - ignoring")
+		return nil
+	}
+	log.Info("no account for password reset - sending notice of such")
+	err := sendEmail(args, passwordResetEmailTask, 0, mc, email, &PasswordResetUnknownParams{Email: email})
+	if err != nil {
+		return workers.Permanent(fmt.Errorf("could not send password reset unknown email to %s: %w", email, err))
 	}
+	return nil
 }
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/emailing"
+	"github.com/keratin/authn-server/app/services"
+)
+
+// Values used in place of real ones when previewing emails
+const (
+	previewTask      = "Preview"
+	previewToken     = "preview-token"
+	previewRecipient = "recipient@example.com"
+)
+
+// sampleParams returns params for purpose filled with placeholder values
+func sampleParams(cfg *config.Config, mc MailContext, purpose emailing.Purpose) emailing.TemplateParams {
+	link := TokenParams{previewToken, tokenLink(cfg, mc, purpose, previewToken)}
+	switch purpose {
+	case emailing.PurposeSignup:
+		return &SignupParams{link}
+	case emailing.PurposeAlreadyRegistered:
+		return &AlreadyRegisteredParams{Email: previewRecipient}
+	case emailing.PurposePasswordReset:
+		return &PasswordResetParams{link}
+	case emailing.PurposePasswordResetNewUser:
+		return &PasswordResetNewUserParams{link}
+	case emailing.PurposePasswordResetExpired:
+		return &PasswordResetExpiredParams{link}
+	case emailing.PurposePasswordResetUnknown:
+		return &PasswordResetUnknownParams{Email: previewRecipient}
+	case emailing.PurposeVerifyEmail:
+		return &VerifyEmailParams{link}
+	case emailing.PurposeEmailChangeNotice:
+		return &EmailChangeNoticeParams{link, previewRecipient}
+	case emailing.PurposeEmailChanged:
+		return &EmailChangedParams{Email: previewRecipient}
+	case emailing.PurposeLogin:
+		return &LoginParams{link}
+	default:
+		return nil
+	}
+}
+
+// previewParams overlays supplied template variables on sample params
+type previewParams struct {
+	emailing.TemplateParams
+	data map[string]interface{}
+}
+
+func (p *previewParams) Params() map[string]interface{} {
+	params := p.TemplateParams.Params()
+	for k, v := range p.data {
+		params[k] = v
+	}
+	return params
+}
+
+// EmailPreviewer renders the template configured for purpose, branded and localised as mc requires, with sample
+// params overridden by any variables in data, without sending it
+func EmailPreviewer(cfg *config.Config, renderer emailing.Renderer, purpose emailing.Purpose, mc MailContext,
+	to string, data map[string]interface{}) (*emailing.Preview, error) {
+	params := sampleParams(cfg, mc, purpose)
+	if params == nil {
+		return nil, services.FieldErrors{{Field: "purpose", Message: services.ErrNotFound}}
+	}
+	id := templateID(cfg, purpose, mc)
+	if id == "" {
+		return nil, services.FieldErrors{{Field: "purpose", Message: services.ErrMissing}}
+	}
+	if to == "" {
+		to = previewRecipient
+	}
+	m, err := emailing.NewMessage(id, to, fromAddress(cfg, mc), &previewParams{TemplateParams: params, data: data},
+		messageOptions(cfg, purpose, previewTask, 0, "")...)
+	if err != nil {
+		return nil, err
+	}
+	return renderer(m)
+}
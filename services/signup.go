@@ -6,8 +6,13 @@ import (
 
 	"code.monax.io/monax/pericyte/config"
 	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/data"
+	"code.monax.io/monax/pericyte/models"
+	"code.monax.io/monax/pericyte/tokens"
 	"code.monax.io/monax/pericyte/tokens/emailverify"
+	"code.monax.io/monax/pericyte/tokens/redemption"
 	"code.monax.io/monax/pericyte/workers"
+	kdata "github.com/keratin/authn-server/app/data"
 	"github.com/keratin/authn-server/app/services"
 	"github.com/sirupsen/logrus"
 )
@@ -21,25 +26,66 @@ func SignupTokenVerifier(token string, cfg *config.Config) (string, error) {
 	return claims.Subject, nil
 }
 
-func SignupEmailDispatcher(args *DispatcherArgs) func(email string) error {
+// SignupCompleter creates the account for the address verified by a signup token, stored under the key of the address
+// unless another variant of it already has an account, and stores the locale the signup was requested in against it. The account exists once it is created so failing to store the locale is only logged.
+func SignupCompleter(store data.UserStoreTransactor, redemptions redemption.Store, cfg *config.Config,
+	logger logrus.FieldLogger, token, username, password string) (*models.UserAccount, *kdata.Account, error) {
+	claims, err := emailverify.Parse(token, cfg)
+	// Email change tokens also verify an address but belong to an existing account
+	if err != nil || claims.AccountID != 0 {
+		return nil, nil, services.FieldErrors{{Field: "token", Message: services.ErrInvalidOrExpired}}
+	}
+	err = redeemToken(redemptions, &claims.Claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing, err := findUserByAddress(store, cfg, claims.Subject)
+	if err != nil {
+		return nil, nil, releaseToken(redemptions, &claims.Claims, err)
+	}
+	if existing != nil {
+		return nil, nil, releaseToken(redemptions, &claims.Claims,
+			services.FieldErrors{{Field: "email", Message: services.ErrTaken}})
+	}
+	user, account, err := UserCreator(store, cfg, &UserCreatorArgs{
+		Email:    addressKey(cfg, claims.Subject),
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		return nil, nil, releaseToken(redemptions, &claims.Claims, err)
+	}
+	if claims.Locale != "" {
+		_, err = store.UpdateLocale(user.ID, claims.Locale)
+		if err != nil {
+			logger.WithError(err).WithFields(logrus.Fields{"scope": "SignupCompleter", "account_id": user.AccountID}).
+				Warn("could not store the signup locale")
+		} else {
+			user.Locale = claims.Locale
+		}
+	}
+	return user, account, nil
+}
+
+func SignupEmailDispatcher(args *DispatcherArgs) func(email string, mc MailContext) error {
 	logger := args.Logger.WithFields(logrus.Fields{"scope": "SignupEmailDispatcher"})
 	cfg := args.Config
 
-	dispatcher := workers.NewDispatcher(args.Queue, args.Params, "SignupEmail",
-		func(ctx context.Context, email string) error {
+	dispatcher := workers.NewDispatcher(args.Queue, args.Params, signupEmailTask,
+		func(ctx context.Context, email string, mc MailContext) error {
 			log := logger.WithField("email_address", email)
-			userAccount, err := args.UserStore.FindUserByEmail(email)
+			userAccount, err := findUserByAddress(args.UserStore, cfg, email)
 			if err != nil {
 				return err
 			}
 			if userAccount != nil {
 				log.Info("email already registered - sending notice of such")
 
-				err = emailing.Send(args.EmailSender, cfg.Email.TemplatesIDs.AlreadyRegistered, email,
-					&cfg.Email.From,
-					"email", email)
+				mc.Locale = preferredLocale(userAccount.Locale, mc.Locale)
+				err = sendEmail(args, signupEmailTask, userAccount.AccountID, mc, email,
+					&AlreadyRegisteredParams{Email: email})
 				if err != nil {
-					return fmt.Errorf("could not already registered email to %s: %v", email, err)
+					return fmt.Errorf("could not already registered email to %s: %w", email, err)
 				}
 				return nil
 			}
@@ -50,24 +96,24 @@ func SignupEmailDispatcher(args *DispatcherArgs) func(email string) error {
 				return fmt.Errorf("could not create signup JWT claims: %v", err)
 			}
 
-			token, err := claims.Sign(cfg.PasswordlessTokenSigningKey)
+			token, err := claims.WithLocale(mc.Locale).Sign(tokens.Keyring(cfg))
 			if err != nil {
 				return fmt.Errorf("could not generate signup JWT token: %v", err)
 			}
 
-			err = emailing.Send(args.EmailSender, cfg.Email.TemplatesIDs.Signup, email, &cfg.Email.From,
-				config.TokenParam, token,
-				config.TokenLinkParam, cfg.Front.CompleteSignupURL(token),
-			)
+			err = sendEmail(args, signupEmailTask, 0, mc, email, &SignupParams{TokenParams{
+				Token:     token,
+				TokenLink: tokenLink(cfg, mc, emailing.PurposeSignup, token),
+			}})
 			if err != nil {
-				return fmt.Errorf("could not send signup email to %s: %v", email, err)
+				return fmt.Errorf("could not send signup email to %s: %w", email, err)
 			}
 			log.Info("signup email sent")
 			return nil
 		},
 		args.ErrorReporter)
 
-	return func(email string) error {
-		return dispatcher(email)
+	return func(email string, mc MailContext) error {
+		return dispatcher(email, mc.dispatched(args.Params, signupEmailTask, email))
 	}
 }
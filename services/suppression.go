@@ -0,0 +1,21 @@
+package services
+
+import (
+	"code.monax.io/monax/pericyte/emailing"
+	"github.com/keratin/authn-server/app/services"
+)
+
+// ErrUndeliverable is the field error message for addresses we know we cannot deliver to
+const ErrUndeliverable = "UNDELIVERABLE"
+
+// SuppressionChecker returns a field error against field when email is on the suppression list
+func SuppressionChecker(store emailing.SuppressionStore, field, email string) error {
+	suppression, err := store.FindSuppression(email)
+	if err != nil {
+		return err
+	}
+	if suppression != nil {
+		return services.FieldErrors{{Field: field, Message: ErrUndeliverable}}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/emailing"
+)
+
+// TokenParams are the params of templates that carry a token and a link to use it
+type TokenParams struct {
+	Token     string `param:"token"`
+	TokenLink string `param:"token_link"`
+}
+
+func (p *TokenParams) Params() map[string]interface{} {
+	return emailing.StructParams(p)
+}
+
+// TokenParamNames returns the template variables of TokenParams. Tokens grant access to accounts so these must never
+// be stored, as in the email archive.
+func TokenParamNames() []string {
+	params := (&TokenParams{}).Params()
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type SignupParams struct {
+	TokenParams
+}
+
+func (*SignupParams) Purpose() emailing.Purpose {
+	return emailing.PurposeSignup
+}
+
+type AlreadyRegisteredParams struct {
+	Email string `param:"email"`
+}
+
+func (*AlreadyRegisteredParams) Purpose() emailing.Purpose {
+	return emailing.PurposeAlreadyRegistered
+}
+
+func (p *AlreadyRegisteredParams) Params() map[string]interface{} {
+	return emailing.StructParams(p)
+}
+
+type PasswordResetParams struct {
+	TokenParams
+}
+
+func (*PasswordResetParams) Purpose() emailing.Purpose {
+	return emailing.PurposePasswordReset
+}
+
+type PasswordResetNewUserParams struct {
+	TokenParams
+}
+
+func (*PasswordResetNewUserParams) Purpose() emailing.Purpose {
+	return emailing.PurposePasswordResetNewUser
+}
+
+type PasswordResetExpiredParams struct {
+	TokenParams
+}
+
+func (*PasswordResetExpiredParams) Purpose() emailing.Purpose {
+	return emailing.PurposePasswordResetExpired
+}
+
+// PasswordResetUnknownParams are for telling someone who asked to reset a password that no account uses their address
+type PasswordResetUnknownParams struct {
+	Email string `param:"email"`
+}
+
+func (*PasswordResetUnknownParams) Purpose() emailing.Purpose {
+	return emailing.PurposePasswordResetUnknown
+}
+
+func (p *PasswordResetUnknownParams) Params() map[string]interface{} {
+	return emailing.StructParams(p)
+}
+
+type VerifyEmailParams struct {
+	TokenParams
+}
+
+func (*VerifyEmailParams) Purpose() emailing.Purpose {
+	return emailing.PurposeVerifyEmail
+}
+
+// EmailChangeNoticeParams are for telling the previous address of an account that a change was requested, the token
+// reverts the change
+type EmailChangeNoticeParams struct {
+	TokenParams
+	NewEmail string `param:"new_email"`
+}
+
+func (*EmailChangeNoticeParams) Purpose() emailing.Purpose {
+	return emailing.PurposeEmailChangeNotice
+}
+
+func (p *EmailChangeNoticeParams) Params() map[string]interface{} {
+	return emailing.StructParams(p)
+}
+
+// EmailChangedParams are for confirming to the new address of an account that the change is complete
+type EmailChangedParams struct {
+	Email string `param:"email"`
+}
+
+func (*EmailChangedParams) Purpose() emailing.Purpose {
+	return emailing.PurposeEmailChanged
+}
+
+func (p *EmailChangedParams) Params() map[string]interface{} {
+	return emailing.StructParams(p)
+}
+
+type LoginParams struct {
+	TokenParams
+}
+
+func (*LoginParams) Purpose() emailing.Purpose {
+	return emailing.PurposeLogin
+}
+
+// Zero params for every purpose, used to check the variables each configured template expects
+var templateParams = []emailing.TemplateParams{
+	new(SignupParams),
+	new(AlreadyRegisteredParams),
+	new(PasswordResetParams),
+	new(PasswordResetNewUserParams),
+	new(PasswordResetExpiredParams),
+	new(PasswordResetUnknownParams),
+	new(VerifyEmailParams),
+	new(EmailChangeNoticeParams),
+	new(EmailChangedParams),
+	new(LoginParams),
+}
+
+// TemplatesChecker checks every configured template, including localised and branded variants, against the params
+// for its purpose, returning an error describing all mismatches
+func TemplatesChecker(cfg *config.Config, inspector emailing.TemplateInspector) error {
+	var errs []error
+	check := func(templateID string, params emailing.TemplateParams) {
+		if templateID == "" {
+			return
+		}
+		if err := emailing.CheckTemplate(inspector, templateID, params); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, params := range templateParams {
+		purpose := params.Purpose()
+		check(defaultTemplateID(cfg, purpose), params)
+		for _, templates := range cfg.Email.LocalizedTemplates {
+			check(templates[purpose], params)
+		}
+		for _, b := range cfg.Email.Brands {
+			check(b.Templates[purpose], params)
+			for _, templates := range b.LocalizedTemplates {
+				check(templates[purpose], params)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("configured email templates do not match their params: %v", errs)
+	}
+	return nil
+}
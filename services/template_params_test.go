@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/emailing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInspector returns the variables of templates by ID, templates it does not know reference nothing
+type fakeInspector map[string][]string
+
+func (i fakeInspector) TemplateVariables(templateID string) ([]string, error) {
+	return i[templateID], nil
+}
+
+func TestTokenParamNames(t *testing.T) {
+	assert.Equal(t, []string{"token", "token_link"}, TokenParamNames())
+	params := (&SignupParams{TokenParams{Token: "t", TokenLink: "https://monax.io/signup?token=t"}}).Params()
+	for _, name := range TokenParamNames() {
+		assert.NotEmpty(t, params[name], "%s carries the token", name)
+	}
+}
+
+func TestTemplatesChecker(t *testing.T) {
+	cfg := &config.Config{Email: &config.Email{}}
+	cfg.Email.TemplatesIDs.Signup = "signup"
+	cfg.Email.TemplatesIDs.EmailChangeNotice = "notice"
+	cfg.Email.LocalizedTemplates = map[string]emailing.Templates{
+		"fr": {emailing.PurposeSignup: "signup-fr"},
+	}
+	cfg.Email.Brands = map[string]*emailing.Brand{
+		"other.monax.io": {Templates: emailing.Templates{emailing.PurposeEmailChanged: "changed-other"}},
+	}
+	inspector := fakeInspector{
+		"signup":        {"token", "token_link", emailing.OriginalRecipientParam},
+		"notice":        {"token_link", "new_email"},
+		"signup-fr":     {"token_link"},
+		"changed-other": {"email"},
+	}
+	require.NoError(t, TemplatesChecker(cfg, inspector))
+
+	inspector["signup-fr"] = []string{"token_link", "name"}
+	inspector["changed-other"] = []string{"new_email"}
+	err := TemplatesChecker(cfg, inspector)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "signup-fr")
+	assert.Contains(t, err.Error(), "changed-other")
+	assert.NotContains(t, err.Error(), "template notice")
+}
+
+func TestTemplateParamsFields(t *testing.T) {
+	// Template data is derived from the tagged fields of params structs
+	params := &EmailChangeNoticeParams{TokenParams{"t", "https://monax.io/revert?token=t"}, "new@monax.io"}
+	assert.Equal(t, map[string]interface{}{
+		"token":      "t",
+		"token_link": "https://monax.io/revert?token=t",
+		"new_email":  "new@monax.io",
+	}, params.Params())
+	for _, params := range templateParams {
+		assert.NotEmpty(t, params.Params(), "%T has no tagged fields", params)
+	}
+}
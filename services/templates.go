@@ -0,0 +1,70 @@
+package services
+
+import (
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/emailing"
+)
+
+// templateID resolves the template for purpose, preferring the brand for the application domain in mc and the
+// variant configured for the closest match to its locale, and falling back to the default template
+func templateID(cfg *config.Config, purpose emailing.Purpose, mc MailContext) string {
+	if b := brand(cfg, mc); b != nil {
+		if id := localizedTemplateID(b.LocalizedTemplates, purpose, mc.Locale); id != "" {
+			return id
+		}
+		if id := b.Templates[purpose]; id != "" {
+			return id
+		}
+	}
+	if id := localizedTemplateID(cfg.Email.LocalizedTemplates, purpose, mc.Locale); id != "" {
+		return id
+	}
+	return defaultTemplateID(cfg, purpose)
+}
+
+func localizedTemplateID(localized map[string]emailing.Templates, purpose emailing.Purpose, locale string) string {
+	locales := make([]string, 0, len(localized))
+	for l := range localized {
+		locales = append(locales, l)
+	}
+	if l, ok := emailing.MatchLocale(locale, locales); ok {
+		return localized[l][purpose]
+	}
+	return ""
+}
+
+func defaultTemplateID(cfg *config.Config, purpose emailing.Purpose) string {
+	ids := cfg.Email.TemplatesIDs
+	switch purpose {
+	case emailing.PurposeSignup:
+		return ids.Signup
+	case emailing.PurposeAlreadyRegistered:
+		return ids.AlreadyRegistered
+	case emailing.PurposePasswordReset:
+		return ids.PasswordReset
+	case emailing.PurposePasswordResetNewUser:
+		return ids.PasswordResetNewUser
+	case emailing.PurposePasswordResetExpired:
+		return ids.PasswordResetExpired
+	case emailing.PurposePasswordResetUnknown:
+		return ids.PasswordResetUnknown
+	case emailing.PurposeVerifyEmail:
+		return ids.VerifyEmail
+	case emailing.PurposeEmailChangeNotice:
+		return ids.EmailChangeNotice
+	case emailing.PurposeEmailChanged:
+		return ids.EmailChanged
+	case emailing.PurposeLogin:
+		return ids.Login
+	default:
+		return ""
+	}
+}
+
+// preferredLocale favours the locale stored against an account over the one captured from the current request
+func preferredLocale(stored, requested string) string {
+	if stored != "" {
+		return stored
+	}
+	return requested
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"code.monax.io/monax/pericyte/tokens/redemption"
+	"github.com/keratin/authn-server/app/services"
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// redeemToken marks the token with claims as used, returning a field error if it already was or cannot be tracked
+func redeemToken(redemptions redemption.Store, claims *jwt.Claims) error {
+	invalid := services.FieldErrors{{Field: "token", Message: services.ErrInvalidOrExpired}}
+	// Tokens issued before IDs were added cannot be redeemed only once
+	if claims.ID == "" || claims.Expiry == nil {
+		return invalid
+	}
+	ok, err := redemptions.Redeem(claims.ID, claims.Expiry.Time())
+	if err != nil {
+		return errors.Wrap(err, "Redeem")
+	}
+	if !ok {
+		return invalid
+	}
+	return nil
+}
+
+// releaseToken undoes redeemToken after consuming the token failed with err, so that the user can correct their
+// input and use it again
+func releaseToken(redemptions redemption.Store, claims *jwt.Claims, err error) error {
+	releaseErr := redemptions.Release(claims.ID)
+	if releaseErr != nil {
+		return errors.Wrapf(releaseErr, "could not release token after: %v", err)
+	}
+	return err
+}
@@ -15,6 +15,27 @@ type DispatcherArgs struct {
 	Params        *workers.Params
 	UserStore     data.UserStore
 	EmailSender   emailing.Sender
+	Attachments   emailing.AttachmentStore
 	ErrorReporter func(error)
 	Logger        logrus.FieldLogger
 }
+
+// MailContext carries request-derived details that affect how an email is presented through to the dispatcher job
+type MailContext struct {
+	// Locale is a BCP 47 language tag used to select a localised template
+	Locale string
+	// Domain is the application domain the request came from, selecting the brand email is sent under
+	Domain string
+	// JobID is set when the job is dispatched so that every attempt at sending its email is tracked as the same job,
+	// and so carries the same idempotency key
+	JobID string
+	// Attachments are sent with the email of the job, such as a document generated for it, after any configured for
+	// its purpose. They travel in the queue message so should reference their content by Location.
+	Attachments []*emailing.Attachment
+}
+
+// dispatched returns mc with the job ID for the job of task with args, which should not include mc
+func (mc MailContext) dispatched(params *workers.Params, task string, args ...interface{}) MailContext {
+	mc.JobID = workers.JobID(params, task, append(args, mc)...)
+	return mc
+}
@@ -6,6 +6,9 @@ import (
 
 	"code.monax.io/monax/pericyte/config"
 	"code.monax.io/monax/pericyte/emailing"
+	"code.monax.io/monax/pericyte/data"
+	"code.monax.io/monax/pericyte/models"
+	"code.monax.io/monax/pericyte/tokens"
 	"code.monax.io/monax/pericyte/tokens/emailverify"
 	"code.monax.io/monax/pericyte/workers"
 	"github.com/keratin/authn-server/app/services"
@@ -14,20 +17,45 @@ import (
 	"github.com/pkg/errors"
 )
 
-func VerifyEmailVerifier(token string, cfg *config.Config) (int, string, error) {
-	claims, err := emailverify.Parse(token, cfg)
+// VerifyEmailVerifier returns the account and new address of an email change token, provided the email and password of
+// the account have not changed, nor the password been expired, since it was issued
+func VerifyEmailVerifier(store data.UserStore, cfg *config.Config, token string) (int, string, error) {
+	claims, _, err := parseEmailChangeToken(store, cfg, token)
 	if err != nil {
-		return 0, "", services.FieldErrors{{Field: "token", Message: services.ErrInvalidOrExpired}}
+		return 0, "", err
 	}
 	return claims.AccountID, claims.Subject, nil
 }
 
-func VerifyEmailDispatcher(args *DispatcherArgs) func(accountID int, email string) error {
+// parseEmailChangeToken returns the claims of an email change token with the account it is for
+func parseEmailChangeToken(store data.UserStore, cfg *config.Config, token string) (*emailverify.Claims,
+	*models.UserAccount, error) {
+	invalid := services.FieldErrors{{Field: "token", Message: services.ErrInvalidOrExpired}}
+	claims, err := emailverify.Parse(token, cfg)
+	// Signup tokens verify an address without an account so cannot change one
+	if err != nil || claims.AccountID == 0 {
+		return nil, nil, invalid
+	}
+	user, err := store.FindUserByAccountID(claims.AccountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, services.FieldErrors{{Field: "user", Message: services.ErrNotFound}}
+	}
+	if !claims.StampMatches(user.Email, user.PasswordChangedAt, user.RequireNewPassword) {
+		return nil, nil, invalid
+	}
+	return claims, user, nil
+}
+
+func VerifyEmailDispatcher(args *DispatcherArgs) func(accountID int, email string, mc MailContext) error {
 	logger := args.Logger.WithFields(logrus.Fields{"scope": "VerifyEmailDispatcher"})
 	cfg := args.Config
+	notice := emailChangeNoticeDispatcher(args)
 
-	dispatcher := workers.NewDispatcher(args.Queue, args.Params, "VerifyEmail",
-		func(ctx context.Context, accountID int, email string) error {
+	dispatcher := workers.NewDispatcher(args.Queue, args.Params, verifyEmailTask,
+		func(ctx context.Context, accountID int, email string, mc MailContext) error {
 			log := logger.WithField("account_id", accountID)
 			log.Info("generating verify email")
 			user, err := args.UserStore.FindUserByAccountID(accountID)
@@ -38,29 +66,46 @@ func VerifyEmailDispatcher(args *DispatcherArgs) func(accountID int, email strin
 				return fmt.Errorf("VerifyEmail: could not find account with ID %v", accountID)
 			}
 
+			if mc.Locale != "" && mc.Locale != user.Locale {
+				// The user is logged in so take the locale of their latest request as their preference
+				_, err = args.UserStore.UpdateLocale(user.ID, mc.Locale)
+				if err != nil {
+					return errors.Wrap(err, "UpdateLocale")
+				}
+				user.Locale = mc.Locale
+			}
+
 			// Generate reset token
 			verify, err := emailverify.New(cfg, email)
 			if err != nil {
 				return errors.Wrap(err, "New Reset")
 			}
 
-			token, err := verify.WithAccountID(accountID).Sign(cfg.PasswordlessTokenSigningKey)
+			token, err := verify.WithAccountID(accountID).
+				WithStamp(user.Email, user.PasswordChangedAt, user.RequireNewPassword).Sign(tokens.Keyring(cfg))
 			if err != nil {
 				return errors.Wrap(err, "Sign")
 			}
 
-			err = emailing.Send(args.EmailSender, cfg.Email.TemplatesIDs.VerifyEmail, user.Email, &cfg.Email.From,
-				config.TokenParam, token,
-				config.TokenLinkParam, cfg.Front.VerifyEmailURL(token))
-
+			mc.Locale = preferredLocale(user.Locale, mc.Locale)
+			// Following the link is what proves the new address belongs to the user
+			err = sendEmail(args, verifyEmailTask, accountID, mc, email, &VerifyEmailParams{TokenParams{
+				Token:     token,
+				TokenLink: tokenLink(cfg, mc, emailing.PurposeVerifyEmail, token),
+			}})
 			if err != nil {
-				return fmt.Errorf("could not send verify email to %s: %v", user.Email, err)
+				return fmt.Errorf("could not send verify email to %s: %w", email, err)
 			}
 			log.Info("verify email sent")
-			return nil
+			if sameAddress(cfg, user.Email, email) {
+				return nil
+			}
+			// Attachments of the job are for the verification only
+			mc.Attachments = nil
+			return notice(accountID, user.Email, email, mc)
 		}, args.ErrorReporter)
 
-	return func(accountID int, email string) error {
-		return dispatcher(accountID, email)
+	return func(accountID int, email string, mc MailContext) error {
+		return dispatcher(accountID, email, mc.dispatched(args.Params, verifyEmailTask, accountID, email))
 	}
 }
@@ -0,0 +1,78 @@
+package emaillogin
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/keys"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const scope = "login"
+
+// Claims authorise logging in to the account with the ID in Subject
+type Claims struct {
+	Scope string `json:"scope"`
+	// Lock is when the password was last changed, a change invalidates the token as it does keratin reset tokens
+	Lock *jwt.NumericDate `json:"lock"`
+	jwt.Claims
+}
+
+func New(cfg *config.Config, accountID int, passwordChangedAt time.Time) (*Claims, error) {
+	return &Claims{
+		Scope: scope,
+		Lock:  jwt.NewNumericDate(passwordChangedAt),
+		Claims: jwt.Claims{
+			ID:       uuid.New().String(),
+			Issuer:   cfg.AuthNURL.String(),
+			Subject:  strconv.Itoa(accountID),
+			Audience: jwt.Audience{cfg.AuthNURL.String()},
+			Expiry:   jwt.NewNumericDate(time.Now().Add(cfg.PasswordlessTokenTTL)),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}, nil
+}
+
+func Parse(tokenStr string, cfg *config.Config) (*Claims, error) {
+	claims := Claims{}
+	err := tokens.Keyring(cfg).Parse(tokenStr, &claims)
+	if err != nil {
+		return nil, errors.Wrap(err, "Parse")
+	}
+
+	err = claims.Claims.Validate(jwt.Expected{
+		Audience: jwt.Audience{cfg.AuthNURL.String()},
+		Issuer:   cfg.AuthNURL.String(),
+		Time:     time.Now(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Validate")
+	}
+	if claims.Scope != scope {
+		return nil, fmt.Errorf("token scope not valid")
+	}
+	if claims.Lock == nil {
+		return nil, fmt.Errorf("token has no lock")
+	}
+
+	return &claims, nil
+}
+
+func (c *Claims) Sign(keyring *keys.Keyring) (string, error) {
+	return keyring.Sign(c)
+}
+
+// AccountID is the account the token logs in to
+func (c *Claims) AccountID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// LockExpired is true if the password has changed since the token was issued
+func (c *Claims) LockExpired(passwordChangedAt time.Time) bool {
+	return c.Lock.Time().Before(passwordChangedAt.Truncate(time.Second))
+}
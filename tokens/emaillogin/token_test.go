@@ -0,0 +1,49 @@
+package emaillogin
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/tokens/emailverify"
+	"code.monax.io/monax/pericyte/tokens/keys"
+	"github.com/keratin/authn-server/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginToken(t *testing.T) {
+	cfg := &config.Config{
+		Config: app.Config{
+			AuthNURL:                    &url.URL{Scheme: "https", Host: "authn.example.com"},
+			PasswordlessTokenSigningKey: []byte("key-a-reno"),
+			PasswordlessTokenTTL:        time.Hour,
+		},
+	}
+	passwordChangedAt := time.Now().Add(-time.Hour)
+
+	t.Run("creating signing and parsing", func(t *testing.T) {
+		token, err := New(cfg, 42, passwordChangedAt)
+		require.NoError(t, err)
+		tokenStr, err := token.Sign(keys.NewKeyring(nil, cfg.PasswordlessTokenSigningKey))
+		require.NoError(t, err)
+
+		claims, err := Parse(tokenStr, cfg)
+		require.NoError(t, err)
+		accountID, err := claims.AccountID()
+		require.NoError(t, err)
+		assert.Equal(t, 42, accountID)
+		assert.False(t, claims.LockExpired(passwordChangedAt))
+		assert.True(t, claims.LockExpired(time.Now()), "changing the password invalidates the token")
+	})
+
+	t.Run("parsing a verification token", func(t *testing.T) {
+		token, err := emailverify.New(cfg, "loon@yellowrustrise.co")
+		require.NoError(t, err)
+		tokenStr, err := token.WithAccountID(42).Sign(keys.NewKeyring(nil, cfg.PasswordlessTokenSigningKey))
+		require.NoError(t, err)
+		_, err = Parse(tokenStr, cfg)
+		assert.Error(t, err)
+	})
+}
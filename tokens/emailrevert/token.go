@@ -0,0 +1,74 @@
+package emailrevert
+
+import (
+	"fmt"
+	"time"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/keys"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const scope = "email_revert"
+
+// DefaultTTL is how long a revert token lasts when no TTL is configured. It must comfortably outlast the verification
+// token for the change so that the change can still be reverted after it is made.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// Claims authorise restoring the email of an account to Subject, the address it had before a change was requested
+type Claims struct {
+	Scope     string `json:"scope"`
+	AccountID int
+	// NewEmail is the address the change was requested to
+	NewEmail string `json:"new_email"`
+	jwt.Claims
+}
+
+func New(cfg *config.Config, accountID int, previousEmail, newEmail string) (*Claims, error) {
+	ttl := cfg.Email.RevertTokenTTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Claims{
+		Scope:     scope,
+		AccountID: accountID,
+		NewEmail:  newEmail,
+		Claims: jwt.Claims{
+			ID:       uuid.New().String(),
+			Issuer:   cfg.AuthNURL.String(),
+			Subject:  previousEmail,
+			Audience: jwt.Audience{cfg.AuthNURL.String()},
+			Expiry:   jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}, nil
+}
+
+func Parse(tokenStr string, cfg *config.Config) (*Claims, error) {
+	claims := Claims{}
+	err := tokens.Keyring(cfg).Parse(tokenStr, &claims)
+	if err != nil {
+		return nil, errors.Wrap(err, "Parse")
+	}
+
+	err = claims.Claims.Validate(jwt.Expected{
+		Audience: jwt.Audience{cfg.AuthNURL.String()},
+		Issuer:   cfg.AuthNURL.String(),
+		Time:     time.Now(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Validate")
+	}
+	if claims.Scope != scope {
+		return nil, fmt.Errorf("token scope not valid")
+	}
+
+	return &claims, nil
+}
+
+func (c *Claims) Sign(keyring *keys.Keyring) (string, error) {
+	return keyring.Sign(c)
+}
@@ -0,0 +1,57 @@
+package emailrevert
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/tokens/emailverify"
+	"code.monax.io/monax/pericyte/tokens/keys"
+	"github.com/keratin/authn-server/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevertToken(t *testing.T) {
+	cfg := &config.Config{
+		Config: app.Config{
+			AuthNURL:                    &url.URL{Scheme: "https", Host: "authn.example.com"},
+			PasswordlessTokenSigningKey: []byte("key-a-reno"),
+			PasswordlessTokenTTL:        3600,
+		},
+		Email: &config.Email{},
+	}
+
+	t.Run("creating signing and parsing", func(t *testing.T) {
+		token, err := New(cfg, 7, "old@example.com", "new@example.com")
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(DefaultTTL), token.Expiry.Time(), time.Minute)
+
+		tokenStr, err := token.Sign(keys.NewKeyring(nil, cfg.PasswordlessTokenSigningKey))
+		require.NoError(t, err)
+
+		claims, err := Parse(tokenStr, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, 7, claims.AccountID)
+		assert.Equal(t, "old@example.com", claims.Subject)
+		assert.Equal(t, "new@example.com", claims.NewEmail)
+	})
+
+	t.Run("parsing a verification token", func(t *testing.T) {
+		token, err := emailverify.New(cfg, "old@example.com")
+		require.NoError(t, err)
+		tokenStr, err := token.WithAccountID(7).Sign(keys.NewKeyring(nil, cfg.PasswordlessTokenSigningKey))
+		require.NoError(t, err)
+		_, err = Parse(tokenStr, cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("configured TTL", func(t *testing.T) {
+		ttlCfg := *cfg
+		ttlCfg.Email = &config.Email{RevertTokenTTL: time.Hour}
+		token, err := New(&ttlCfg, 7, "old@example.com", "new@example.com")
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry.Time(), time.Minute)
+	})
+}
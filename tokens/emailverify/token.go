@@ -1,12 +1,17 @@
 package emailverify
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
 	"time"
 
 	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/keys"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
-	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
 )
 
@@ -16,6 +21,10 @@ type Claims struct {
 	Scope string `json:"scope"`
 	// AccountID authorises an email change for a particular account
 	AccountID int
+	// Stamp binds an email change token to the state of the account it was issued for, see WithStamp
+	Stamp string `json:"stamp,omitempty"`
+	// Locale records the language the token was requested in so it can be stored against the account created with it
+	Locale string `json:"locale,omitempty"`
 	jwt.Claims
 }
 
@@ -23,6 +32,8 @@ func New(cfg *config.Config, email string) (*Claims, error) {
 	return &Claims{
 		Scope: scope,
 		Claims: jwt.Claims{
+			// Identifies the token so that it can only be used once
+			ID:       uuid.New().String(),
 			Issuer:   cfg.AuthNURL.String(),
 			Subject:  email,
 			Audience: jwt.Audience{cfg.AuthNURL.String()},
@@ -33,15 +44,10 @@ func New(cfg *config.Config, email string) (*Claims, error) {
 }
 
 func Parse(tokenStr string, cfg *config.Config) (*Claims, error) {
-	token, err := jwt.ParseSigned(tokenStr)
-	if err != nil {
-		return nil, errors.Wrap(err, "ParseSigned")
-	}
-
 	claims := Claims{}
-	err = token.Claims(cfg.PasswordlessTokenSigningKey, &claims)
+	err := tokens.Keyring(cfg).Parse(tokenStr, &claims)
 	if err != nil {
-		return nil, errors.Wrap(err, "Claims")
+		return nil, errors.Wrap(err, "Parse")
 	}
 
 	err = claims.Claims.Validate(jwt.Expected{
@@ -55,22 +61,43 @@ func Parse(tokenStr string, cfg *config.Config) (*Claims, error) {
 	if claims.Scope != scope {
 		return nil, fmt.Errorf("token scope not valid")
 	}
+	if claims.AccountID != 0 && claims.Stamp == "" {
+		return nil, fmt.Errorf("token has no stamp")
+	}
 
 	return &claims, nil
 }
 
-func (c *Claims) Sign(hmacKey []byte) (string, error) {
-	signer, err := jose.NewSigner(
-		jose.SigningKey{Algorithm: jose.HS256, Key: hmacKey},
-		(&jose.SignerOptions{}).WithType("JWT"),
-	)
-	if err != nil {
-		return "", errors.Wrap(err, "NewSigner")
-	}
-	return jwt.Signed(signer).Claims(c).CompactSerialize()
+func (c *Claims) Sign(keyring *keys.Keyring) (string, error) {
+	return keyring.Sign(c)
 }
 
 func (c *Claims) WithAccountID(accountID int) *Claims {
 	c.AccountID = accountID
 	return c
 }
+
+// WithStamp binds the token to the current email and password of its account, so that changing either invalidates it
+// as changing the password does keratin reset tokens. Expiring the password also invalidates it, and the reset that
+// follows changes the password, so that a revert or an administrator locking out whoever had access ends their
+// pending changes.
+func (c *Claims) WithStamp(email string, passwordChangedAt time.Time, requireNewPassword bool) *Claims {
+	c.Stamp = stamp(email, passwordChangedAt, requireNewPassword)
+	return c
+}
+
+// StampMatches returns whether the account is as it was when the token was issued
+func (c *Claims) StampMatches(email string, passwordChangedAt time.Time, requireNewPassword bool) bool {
+	return subtle.ConstantTimeCompare([]byte(c.Stamp),
+		[]byte(stamp(email, passwordChangedAt, requireNewPassword))) == 1
+}
+
+func stamp(email string, passwordChangedAt time.Time, requireNewPassword bool) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%t", email, passwordChangedAt.Unix(), requireNewPassword)))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (c *Claims) WithLocale(locale string) *Claims {
+	c.Locale = locale
+	return c
+}
@@ -1,10 +1,14 @@
 package emailverify
 
 import (
+	"encoding/base64"
 	"net/url"
 	"testing"
+	"time"
 
 	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/tokens"
+	"code.monax.io/monax/pericyte/tokens/keys"
 	"github.com/keratin/authn-server/app"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,7 +36,7 @@ func TestSignupToken(t *testing.T) {
 		assert.NotEmpty(t, token.Expiry)
 		assert.NotEmpty(t, token.IssuedAt)
 
-		tokenStr, err := token.Sign(cfg.PasswordlessTokenSigningKey)
+		tokenStr, err := token.Sign(keys.NewKeyring(nil, cfg.PasswordlessTokenSigningKey))
 		require.NoError(t, err)
 
 		_, err = Parse(tokenStr, cfg)
@@ -49,12 +53,79 @@ func TestSignupToken(t *testing.T) {
 		}
 		token, err := New(&oldCfg, email)
 		require.NoError(t, err)
-		tokenStr, err := token.Sign(oldCfg.PasswordlessTokenSigningKey)
+		tokenStr, err := token.Sign(keys.NewKeyring(nil, oldCfg.PasswordlessTokenSigningKey))
 		require.NoError(t, err)
 		_, err = Parse(tokenStr, cfg)
 		assert.Error(t, err)
 	})
 
+	t.Run("parsing after rotating keys", func(t *testing.T) {
+		oldKey := &keys.Key{ID: "old", Secret: "old-a-reno", ActiveFrom: time.Now().Add(-time.Hour)}
+		oldCfg := *cfg
+		oldCfg.PasswordlessTokenKeys = []*keys.Key{oldKey}
+		token, err := New(&oldCfg, email)
+		require.NoError(t, err)
+		tokenStr, err := token.Sign(keys.NewKeyring(oldCfg.PasswordlessTokenKeys, nil))
+		require.NoError(t, err)
+
+		newCfg := oldCfg
+		newCfg.PasswordlessTokenKeys = []*keys.Key{oldKey, {ID: "new", Secret: "new-a-reno", ActiveFrom: time.Now()}}
+		_, err = Parse(tokenStr, &newCfg)
+		require.NoError(t, err)
+
+		retiredKey := *oldKey
+		retiredKey.RetireAt = time.Now()
+		newCfg.PasswordlessTokenKeys = []*keys.Key{&retiredKey, newCfg.PasswordlessTokenKeys[1]}
+		_, err = Parse(tokenStr, &newCfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("encrypting", func(t *testing.T) {
+		encryptedCfg := *cfg
+		encryptedCfg.PasswordlessTokenEncryptionKey = "secret-a-reno"
+		token, err := New(&encryptedCfg, email)
+		require.NoError(t, err)
+		tokenStr, err := token.Sign(tokens.Keyring(&encryptedCfg))
+		require.NoError(t, err)
+		assert.NotContains(t, tokenStr, base64.RawURLEncoding.EncodeToString([]byte(email))[:8])
+
+		claims, err := Parse(tokenStr, &encryptedCfg)
+		require.NoError(t, err)
+		assert.Equal(t, email, claims.Subject)
+		_, err = Parse(tokenStr, cfg)
+		assert.Error(t, err)
+
+		legacyStr, err := token.Sign(tokens.Keyring(cfg))
+		require.NoError(t, err)
+		_, err = Parse(legacyStr, &encryptedCfg)
+		assert.NoError(t, err, "tokens signed before encryption was configured are accepted")
+
+		encryptedCfg.PasswordlessTokenEncryptionRequired = true
+		_, err = Parse(legacyStr, &encryptedCfg)
+		assert.Error(t, err, "only encrypted tokens are accepted once encryption is required")
+		_, err = Parse(tokenStr, &encryptedCfg)
+		assert.NoError(t, err)
+	})
+
+	t.Run("stamping email change tokens", func(t *testing.T) {
+		changedAt := time.Now()
+		token, err := New(cfg, email)
+		require.NoError(t, err)
+		tokenStr, err := token.WithAccountID(42).Sign(tokens.Keyring(cfg))
+		require.NoError(t, err)
+		_, err = Parse(tokenStr, cfg)
+		assert.Error(t, err, "email change tokens must be stamped")
+
+		tokenStr, err = token.WithStamp("old@yellowrustrise.co", changedAt, false).Sign(tokens.Keyring(cfg))
+		require.NoError(t, err)
+		claims, err := Parse(tokenStr, cfg)
+		require.NoError(t, err)
+		assert.True(t, claims.StampMatches("old@yellowrustrise.co", changedAt, false))
+		assert.False(t, claims.StampMatches("new@yellowrustrise.co", changedAt, false))
+		assert.False(t, claims.StampMatches("old@yellowrustrise.co", changedAt.Add(time.Second), false))
+		assert.False(t, claims.StampMatches("old@yellowrustrise.co", changedAt, true), "expiring the password")
+	})
+
 	t.Run("parsing with an unknown issuer and audience", func(t *testing.T) {
 		oldCfg := config.Config{
 			Config: app.Config{
@@ -65,7 +136,7 @@ func TestSignupToken(t *testing.T) {
 		}
 		token, err := New(&oldCfg, email)
 		require.NoError(t, err)
-		tokenStr, err := token.Sign(oldCfg.PasswordlessTokenSigningKey)
+		tokenStr, err := token.Sign(keys.NewKeyring(nil, oldCfg.PasswordlessTokenSigningKey))
 		require.NoError(t, err)
 		_, err = Parse(tokenStr, cfg)
 		assert.Error(t, err)
@@ -0,0 +1,438 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Key signs tokens, identified in the tokens it signs by the kid header. It is either an HMAC Secret, or an RSA,
+// ECDSA or Ed25519 private key whose public key is published so that other services can verify our tokens.
+type Key struct {
+	ID     string
+	Secret string
+	// PEM encoded PKCS #1, SEC 1 or PKCS #8 private key, or a file holding one
+	PrivateKey     string
+	PrivateKeyFile string
+	// When the key starts signing tokens. Keys verify tokens as soon as they are configured so a key can be added to
+	// every instance before any of them sign with it.
+	ActiveFrom time.Time
+	// When the key stops verifying tokens, zero for never. To rotate a key add its replacement with a later ActiveFrom
+	// and retire the old key once the tokens it signed have expired.
+	RetireAt time.Time
+
+	// Set by Load from PrivateKey
+	private   crypto.Signer
+	algorithm jose.SignatureAlgorithm
+}
+
+func (k *Key) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+func (k *Key) asymmetric() bool {
+	return k.PrivateKey != "" || k.PrivateKeyFile != ""
+}
+
+func (k *Key) load() error {
+	if !k.asymmetric() {
+		return nil
+	}
+	data := []byte(k.PrivateKey)
+	if k.PrivateKeyFile != "" {
+		var err error
+		data, err = ioutil.ReadFile(k.PrivateKeyFile)
+		if err != nil {
+			return err
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("no PEM data found")
+	}
+	var private interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch p := private.(type) {
+	case *rsa.PrivateKey:
+		k.algorithm = jose.RS256
+	case *ecdsa.PrivateKey:
+		switch p.Curve {
+		case elliptic.P256():
+			k.algorithm = jose.ES256
+		case elliptic.P384():
+			k.algorithm = jose.ES384
+		case elliptic.P521():
+			k.algorithm = jose.ES512
+		default:
+			return fmt.Errorf("unsupported curve %s", p.Curve.Params().Name)
+		}
+	case ed25519.PrivateKey:
+		k.algorithm = jose.EdDSA
+	default:
+		return fmt.Errorf("unsupported key type %T", private)
+	}
+	k.private = private.(crypto.Signer)
+	return nil
+}
+
+// signingKey returns the key to sign with, or to verify with when public is set
+func (k *Key) signingKey(public bool) (interface{}, error) {
+	if !k.asymmetric() {
+		return []byte(k.Secret), nil
+	}
+	if k.private == nil {
+		return nil, fmt.Errorf("token signing key %s has not been loaded", k.ID)
+	}
+	if public {
+		return k.private.Public(), nil
+	}
+	return k.private, nil
+}
+
+// EncryptionKey encrypts tokens so that their claims cannot be read by whoever sees them, identified in the tokens it
+// encrypts by the kid header. Encryption keys rotate like signing keys, see Key.
+type EncryptionKey struct {
+	ID string
+	// Base64 encoded 32 random bytes used as an AES-256 key, such as the output of openssl rand -base64 32
+	Secret     string
+	ActiveFrom time.Time
+	RetireAt   time.Time
+
+	// Set by Load from Secret
+	key []byte
+}
+
+// MinLegacyEncryptionSecretLength is the shortest passphrase accepted as the legacy encryption key
+const MinLegacyEncryptionSecretLength = 32
+
+func (k *EncryptionKey) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+func (k *EncryptionKey) load() error {
+	key, err := base64.StdEncoding.DecodeString(k.Secret)
+	if err != nil {
+		return err
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("secret must be 32 bytes but is %d", len(key))
+	}
+	k.key = key
+	return nil
+}
+
+// Keyring signs tokens with its active key and verifies them with any key that is not retired
+type Keyring struct {
+	keys []*Key
+	// Signs when no key is active and verifies tokens without a kid, as signed before keys were configured
+	legacy []byte
+	// Encrypt signed tokens, none to leave them readable
+	encryptionKeys []*EncryptionKey
+	// Passphrase from which the AES-256 key encrypting tokens is derived when no encryption key is active, and that
+	// decrypts tokens without a kid, as encrypted before encryption keys were configured
+	legacyEncryption string
+	// Reject tokens that are only signed
+	requireEncryption bool
+}
+
+func NewKeyring(keys []*Key, legacy []byte) *Keyring {
+	return &Keyring{keys: keys, legacy: legacy}
+}
+
+// WithEncryption has the keyring encrypt the tokens it signs with its active encryption key, or else a key derived from
+// the legacy secret, so that the claims cannot be read from the token by whoever sees it. No keys and an empty secret
+// leave tokens signed only. Encrypted tokens can only be verified by services holding the key, whatever key signed
+// them.
+func (r *Keyring) WithEncryption(keys []*EncryptionKey, legacy string) *Keyring {
+	r.encryptionKeys = keys
+	r.legacyEncryption = legacy
+	return r
+}
+
+// RequireEncryption has the keyring reject tokens that are signed but not encrypted, once links sent before encryption
+// was turned on have expired
+func (r *Keyring) RequireEncryption(require bool) *Keyring {
+	r.requireEncryption = require
+	return r
+}
+
+// Load reads and parses the private and encryption keys of the keyring, returning an error if any key cannot be used,
+// shares its ID, or nothing can sign, or encrypt when configured to, tokens at now. It must be called once before
+// tokens are signed or verified with asymmetric keys or encrypted with encryption keys.
+func (r *Keyring) Load(now time.Time) error {
+	ids := make(map[string]bool)
+	for _, k := range r.keys {
+		if k.ID == "" || (k.Secret == "" && !k.asymmetric()) || (k.Secret != "" && k.asymmetric()) {
+			return fmt.Errorf("token signing keys need an ID and one of a secret or a private key")
+		}
+		if ids[k.ID] {
+			return fmt.Errorf("token signing key ID %s is not unique", k.ID)
+		}
+		ids[k.ID] = true
+		err := k.load()
+		if err != nil {
+			return fmt.Errorf("could not load token signing key %s: %v", k.ID, err)
+		}
+	}
+	_, err := r.active(now)
+	if err != nil {
+		return err
+	}
+
+	ids = make(map[string]bool)
+	for _, k := range r.encryptionKeys {
+		if k.ID == "" {
+			return fmt.Errorf("token encryption keys need an ID")
+		}
+		if ids[k.ID] {
+			return fmt.Errorf("token encryption key ID %s is not unique", k.ID)
+		}
+		ids[k.ID] = true
+		err = k.load()
+		if err != nil {
+			return fmt.Errorf("could not load token encryption key %s: %v", k.ID, err)
+		}
+	}
+	if r.legacyEncryption != "" && len(r.legacyEncryption) < MinLegacyEncryptionSecretLength {
+		return fmt.Errorf("the legacy token encryption key must be at least %d characters",
+			MinLegacyEncryptionSecretLength)
+	}
+	_, key, err := r.activeEncryption(now)
+	if err != nil {
+		return err
+	}
+	if key == nil && (r.requireEncryption || len(r.encryptionKeys) > 0) {
+		return fmt.Errorf("no token encryption key is active")
+	}
+	return nil
+}
+
+// active returns the key that started signing most recently, or nil to sign with the legacy key
+func (r *Keyring) active(now time.Time) (*Key, error) {
+	var active *Key
+	for _, k := range r.keys {
+		if k.ActiveFrom.After(now) || k.retired(now) {
+			continue
+		}
+		if active == nil || k.ActiveFrom.After(active.ActiveFrom) {
+			active = k
+		}
+	}
+	if active == nil && len(r.legacy) == 0 {
+		return nil, fmt.Errorf("no token signing key is active")
+	}
+	return active, nil
+}
+
+// activeEncryption returns the ID and AES-256 key of the encryption key that started encrypting most recently, an empty
+// ID with the key derived from the legacy secret if none has, or a nil key to leave tokens signed only
+func (r *Keyring) activeEncryption(now time.Time) (string, []byte, error) {
+	var active *EncryptionKey
+	for _, k := range r.encryptionKeys {
+		if k.ActiveFrom.After(now) || k.retired(now) {
+			continue
+		}
+		if active == nil || k.ActiveFrom.After(active.ActiveFrom) {
+			active = k
+		}
+	}
+	if active == nil {
+		return "", r.legacyEncryptionKey(), nil
+	}
+	if active.key == nil {
+		return "", nil, fmt.Errorf("token encryption key %s has not been loaded", active.ID)
+	}
+	return active.ID, active.key, nil
+}
+
+// decryption returns the AES-256 key that decrypts tokens encrypted by the key with id, empty for the legacy key
+func (r *Keyring) decryption(id string) ([]byte, error) {
+	if id == "" {
+		key := r.legacyEncryptionKey()
+		if key == nil {
+			return nil, fmt.Errorf("token has no encryption key ID")
+		}
+		return key, nil
+	}
+	for _, k := range r.encryptionKeys {
+		if k.ID != id {
+			continue
+		}
+		if k.retired(time.Now()) {
+			return nil, fmt.Errorf("token encryption key %s is retired", k.ID)
+		}
+		if k.key == nil {
+			return nil, fmt.Errorf("token encryption key %s has not been loaded", k.ID)
+		}
+		return k.key, nil
+	}
+	return nil, fmt.Errorf("unknown token encryption key %s", id)
+}
+
+func (r *Keyring) legacyEncryptionKey() []byte {
+	if r.legacyEncryption == "" {
+		return nil
+	}
+	key := sha256.Sum256([]byte(r.legacyEncryption))
+	return key[:]
+}
+
+// Sign serialises claims as a JWT signed with the active key, and encrypted with the active encryption key if any
+func (r *Keyring) Sign(claims interface{}) (string, error) {
+	now := time.Now()
+	key, err := r.active(now)
+	if err != nil {
+		return "", err
+	}
+	encryptionID, encryptionKey, err := r.activeEncryption(now)
+	if err != nil {
+		return "", err
+	}
+	signingKey := jose.SigningKey{Algorithm: jose.HS256, Key: r.legacy}
+	opts := (&jose.SignerOptions{}).WithType("JWT")
+	if key != nil {
+		signingKey.Algorithm = algorithm(key)
+		signingKey.Key, err = key.signingKey(false)
+		if err != nil {
+			return "", err
+		}
+		opts = opts.WithHeader("kid", key.ID)
+	}
+	signer, err := jose.NewSigner(signingKey, opts)
+	if err != nil {
+		return "", errors.Wrap(err, "NewSigner")
+	}
+	if encryptionKey == nil {
+		return jwt.Signed(signer).Claims(claims).CompactSerialize()
+	}
+	encrypter, err := jose.NewEncrypter(jose.A256GCM,
+		jose.Recipient{Algorithm: jose.DIRECT, Key: encryptionKey, KeyID: encryptionID},
+		(&jose.EncrypterOptions{}).WithType("JWT").WithContentType("JWT"))
+	if err != nil {
+		return "", errors.Wrap(err, "NewEncrypter")
+	}
+	return jwt.SignedAndEncrypted(signer, encrypter).Claims(claims).CompactSerialize()
+}
+
+// Parse verifies a token serialised by Sign and unmarshals its claims into out. Tokens signed but not encrypted are
+// accepted unless encryption is required, so that links sent before encryption was turned on keep working.
+func (r *Keyring) Parse(tokenStr string, out interface{}) error {
+	// Compact JWEs have five parts and JWSs three
+	if strings.Count(tokenStr, ".") != 4 {
+		if r.requireEncryption {
+			return fmt.Errorf("token is not encrypted")
+		}
+		token, err := jwt.ParseSigned(tokenStr)
+		if err != nil {
+			return errors.Wrap(err, "ParseSigned")
+		}
+		return r.Claims(token, out)
+	}
+	nested, err := jwt.ParseSignedAndEncrypted(tokenStr)
+	if err != nil {
+		return errors.Wrap(err, "ParseSignedAndEncrypted")
+	}
+	if len(nested.Headers) != 1 {
+		return fmt.Errorf("token must have a single recipient")
+	}
+	header := nested.Headers[0]
+	// Only what Sign produces is decrypted, so that a token cannot choose costly or weaker algorithms
+	if header.Algorithm != string(jose.DIRECT) ||
+		header.ExtraHeaders[jose.HeaderKey("enc")] != string(jose.A256GCM) {
+		return fmt.Errorf("token encryption %s %v is not %s %s", header.Algorithm,
+			header.ExtraHeaders[jose.HeaderKey("enc")], jose.DIRECT, jose.A256GCM)
+	}
+	key, err := r.decryption(header.KeyID)
+	if err != nil {
+		return err
+	}
+	token, err := nested.Decrypt(key)
+	if err != nil {
+		return errors.Wrap(err, "Decrypt")
+	}
+	return r.Claims(token, out)
+}
+
+// Claims verifies token with the key named by its kid header and unmarshals its claims into out
+func (r *Keyring) Claims(token *jwt.JSONWebToken, out interface{}) error {
+	if len(token.Headers) != 1 {
+		return fmt.Errorf("token must have a single signature")
+	}
+	header := token.Headers[0]
+	if header.KeyID == "" {
+		if len(r.legacy) == 0 || header.Algorithm != string(jose.HS256) {
+			return fmt.Errorf("token has no key ID")
+		}
+		return token.Claims(r.legacy, out)
+	}
+	now := time.Now()
+	for _, k := range r.keys {
+		if k.ID != header.KeyID {
+			continue
+		}
+		if k.retired(now) {
+			return fmt.Errorf("token signing key %s is retired", k.ID)
+		}
+		// The algorithm is fixed by the key rather than trusted from the token
+		if header.Algorithm != string(algorithm(k)) {
+			return fmt.Errorf("token algorithm %s does not match key %s", header.Algorithm, k.ID)
+		}
+		key, err := k.signingKey(true)
+		if err != nil {
+			return err
+		}
+		return token.Claims(key, out)
+	}
+	return fmt.Errorf("unknown token signing key %s", header.KeyID)
+}
+
+// PublicKeys returns the public keys of the asymmetric keys that are not retired, for publishing as a JWKS
+func (r *Keyring) PublicKeys() jose.JSONWebKeySet {
+	set := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	now := time.Now()
+	for _, k := range r.keys {
+		if !k.asymmetric() || k.private == nil || k.retired(now) {
+			continue
+		}
+		set.Keys = append(set.Keys, jose.JSONWebKey{
+			Key:       k.private.Public(),
+			KeyID:     k.ID,
+			Algorithm: string(k.algorithm),
+			Use:       "sig",
+		})
+	}
+	return set
+}
+
+func algorithm(k *Key) jose.SignatureAlgorithm {
+	if !k.asymmetric() {
+		return jose.HS256
+	}
+	return k.algorithm
+}
@@ -0,0 +1,314 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestKeyring(t *testing.T) {
+	now := time.Now()
+	old := &Key{ID: "old", Secret: "old-a-reno", ActiveFrom: now.Add(-48 * time.Hour)}
+	current := &Key{ID: "current", Secret: "key-a-reno", ActiveFrom: now.Add(-time.Hour)}
+	next := &Key{ID: "next", Secret: "next-a-reno", ActiveFrom: now.Add(time.Hour)}
+	claims := jwt.Claims{Subject: "loon@yellowrustrise.co"}
+
+	sign := func(keyring *Keyring) *jwt.JSONWebToken {
+		tokenStr, err := keyring.Sign(claims)
+		require.NoError(t, err)
+		token, err := jwt.ParseSigned(tokenStr)
+		require.NoError(t, err)
+		return token
+	}
+
+	t.Run("signing with the active key", func(t *testing.T) {
+		keyring := NewKeyring([]*Key{old, current, next}, nil)
+		require.NoError(t, keyring.Load(now))
+		token := sign(keyring)
+		assert.Equal(t, "current", token.Headers[0].KeyID)
+
+		out := jwt.Claims{}
+		require.NoError(t, keyring.Claims(token, &out))
+		assert.Equal(t, claims.Subject, out.Subject)
+	})
+
+	t.Run("verifying tokens signed before rotation", func(t *testing.T) {
+		token := sign(NewKeyring([]*Key{old}, nil))
+		require.NoError(t, NewKeyring([]*Key{old, current, next}, nil).Claims(token, &jwt.Claims{}))
+
+		retired := *old
+		retired.RetireAt = now
+		assert.Error(t, NewKeyring([]*Key{&retired, current}, nil).Claims(token, &jwt.Claims{}))
+		assert.Error(t, NewKeyring([]*Key{current}, nil).Claims(token, &jwt.Claims{}))
+	})
+
+	t.Run("verifying tokens signed by a key not yet active here", func(t *testing.T) {
+		token := sign(NewKeyring([]*Key{{ID: "next", Secret: next.Secret}}, nil))
+		assert.NoError(t, NewKeyring([]*Key{current, next}, nil).Claims(token, &jwt.Claims{}))
+	})
+
+	t.Run("legacy key", func(t *testing.T) {
+		legacy := []byte("legacy-a-reno")
+		token := sign(NewKeyring(nil, legacy))
+		assert.Empty(t, token.Headers[0].KeyID)
+		assert.NoError(t, NewKeyring([]*Key{current}, legacy).Claims(token, &jwt.Claims{}))
+		assert.Error(t, NewKeyring([]*Key{current}, nil).Claims(token, &jwt.Claims{}))
+
+		token = sign(NewKeyring([]*Key{current}, legacy))
+		assert.Equal(t, "current", token.Headers[0].KeyID, "configured keys take over from the legacy key")
+	})
+
+	t.Run("forging a key ID", func(t *testing.T) {
+		token := sign(NewKeyring([]*Key{{ID: "current", Secret: "guessed"}}, nil))
+		assert.Error(t, NewKeyring([]*Key{current}, nil).Claims(token, &jwt.Claims{}))
+	})
+
+	t.Run("loading", func(t *testing.T) {
+		assert.Error(t, NewKeyring([]*Key{next}, nil).Load(now), "no key is active yet")
+		assert.Error(t, NewKeyring([]*Key{current, {ID: "current", Secret: "other"}}, nil).Load(now))
+		assert.Error(t, NewKeyring([]*Key{{ID: "blank"}}, nil).Load(now))
+		assert.NoError(t, NewKeyring([]*Key{next}, []byte("legacy-a-reno")).Load(now))
+	})
+}
+
+func TestKeyringEncryption(t *testing.T) {
+	current := &Key{ID: "current", Secret: "key-a-reno"}
+	claims := jwt.Claims{Subject: "loon@yellowrustrise.co"}
+	signed := NewKeyring([]*Key{current}, nil)
+	encrypted := NewKeyring([]*Key{current}, nil).WithEncryption(nil, "secret-a-reno")
+
+	tokenStr, err := encrypted.Sign(claims)
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(tokenStr, "."))
+	for _, part := range strings.Split(tokenStr, ".") {
+		decoded, _ := base64.RawURLEncoding.DecodeString(part)
+		assert.NotContains(t, string(decoded), claims.Subject)
+	}
+	out := jwt.Claims{}
+	require.NoError(t, encrypted.Parse(tokenStr, &out))
+	assert.Equal(t, claims.Subject, out.Subject)
+	assert.Error(t, signed.Parse(tokenStr, &jwt.Claims{}))
+	assert.Error(t, NewKeyring([]*Key{current}, nil).WithEncryption(nil, "other-a-reno").Parse(tokenStr, &jwt.Claims{}))
+
+	t.Run("parsing tokens signed before encryption", func(t *testing.T) {
+		tokenStr, err := signed.Sign(claims)
+		require.NoError(t, err)
+		assert.NoError(t, encrypted.Parse(tokenStr, &jwt.Claims{}))
+	})
+
+	t.Run("encrypting a token signed by another key", func(t *testing.T) {
+		tokenStr, err := NewKeyring([]*Key{{ID: "current", Secret: "guessed"}}, nil).
+			WithEncryption(nil, "secret-a-reno").Sign(claims)
+		require.NoError(t, err)
+		assert.Error(t, encrypted.Parse(tokenStr, &jwt.Claims{}))
+	})
+}
+
+func TestKeyringEncryptionKeys(t *testing.T) {
+	now := time.Now()
+	current := &Key{ID: "current", Secret: "key-a-reno"}
+	claims := jwt.Claims{Subject: "loon@yellowrustrise.co"}
+	encryptionKey := func(id string, activeFrom time.Time) *EncryptionKey {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		require.NoError(t, err)
+		return &EncryptionKey{ID: id, Secret: base64.StdEncoding.EncodeToString(secret), ActiveFrom: activeFrom}
+	}
+	old := encryptionKey("old", now.Add(-48*time.Hour))
+	next := encryptionKey("next", now.Add(-time.Hour))
+	legacy := "legacy-a-reno-legacy-a-reno-legacy-a-reno"
+	keyring := func(keys []*EncryptionKey, legacy string) *Keyring {
+		keyring := NewKeyring([]*Key{current}, nil).WithEncryption(keys, legacy)
+		require.NoError(t, keyring.Load(now))
+		return keyring
+	}
+	sign := func(keyring *Keyring) string {
+		tokenStr, err := keyring.Sign(claims)
+		require.NoError(t, err)
+		return tokenStr
+	}
+	encryptionKeyID := func(tokenStr string) string {
+		nested, err := jwt.ParseSignedAndEncrypted(tokenStr)
+		require.NoError(t, err)
+		return nested.Headers[0].KeyID
+	}
+
+	t.Run("encrypting with the active key", func(t *testing.T) {
+		rotated := keyring([]*EncryptionKey{old, next}, legacy)
+		tokenStr := sign(rotated)
+		assert.Equal(t, "next", encryptionKeyID(tokenStr))
+		out := jwt.Claims{}
+		require.NoError(t, rotated.Parse(tokenStr, &out))
+		assert.Equal(t, claims.Subject, out.Subject)
+	})
+
+	t.Run("decrypting tokens encrypted before rotation", func(t *testing.T) {
+		legacyStr := sign(keyring(nil, legacy))
+		assert.Empty(t, encryptionKeyID(legacyStr))
+		oldStr := sign(keyring([]*EncryptionKey{old}, ""))
+		assert.Equal(t, "old", encryptionKeyID(oldStr))
+
+		rotated := keyring([]*EncryptionKey{old, next}, legacy)
+		assert.NoError(t, rotated.Parse(legacyStr, &jwt.Claims{}))
+		assert.NoError(t, rotated.Parse(oldStr, &jwt.Claims{}))
+
+		retired := *old
+		retired.RetireAt = now
+		assert.Error(t, keyring([]*EncryptionKey{&retired, next}, "").Parse(oldStr, &jwt.Claims{}))
+		assert.Error(t, keyring([]*EncryptionKey{next}, "").Parse(oldStr, &jwt.Claims{}))
+		assert.Error(t, keyring([]*EncryptionKey{next}, "").Parse(legacyStr, &jwt.Claims{}))
+	})
+
+	t.Run("encryption algorithms", func(t *testing.T) {
+		rotated := keyring([]*EncryptionKey{old, next}, legacy)
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte(current.Secret)},
+			(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", current.ID))
+		require.NoError(t, err)
+		encrypt := func(recipient jose.Recipient, enc jose.ContentEncryption) string {
+			encrypter, err := jose.NewEncrypter(enc, recipient,
+				(&jose.EncrypterOptions{}).WithType("JWT").WithContentType("JWT"))
+			require.NoError(t, err)
+			tokenStr, err := jwt.SignedAndEncrypted(signer, encrypter).Claims(claims).CompactSerialize()
+			require.NoError(t, err)
+			return tokenStr
+		}
+
+		assert.NoError(t, rotated.Parse(encrypt(jose.Recipient{Algorithm: jose.DIRECT, Key: next.key, KeyID: next.ID},
+			jose.A256GCM), &jwt.Claims{}))
+		assert.Error(t, rotated.Parse(encrypt(jose.Recipient{Algorithm: jose.DIRECT, Key: next.key, KeyID: next.ID},
+			jose.A128CBC_HS256), &jwt.Claims{}), "content encryption is fixed")
+		assert.Error(t, rotated.Parse(encrypt(jose.Recipient{Algorithm: jose.PBES2_HS256_A128KW, Key: legacy,
+			PBES2Count: 100000}, jose.A256GCM), &jwt.Claims{}), "key management is fixed")
+	})
+
+	t.Run("requiring encryption", func(t *testing.T) {
+		signedStr := sign(NewKeyring([]*Key{current}, nil))
+		assert.NoError(t, keyring([]*EncryptionKey{next}, "").Parse(signedStr, &jwt.Claims{}))
+
+		required := keyring([]*EncryptionKey{next}, "").RequireEncryption(true)
+		assert.Error(t, required.Parse(signedStr, &jwt.Claims{}), "tokens must be encrypted")
+		assert.NoError(t, required.Parse(sign(required), &jwt.Claims{}))
+	})
+
+	t.Run("loading", func(t *testing.T) {
+		load := func(keys []*EncryptionKey, legacy string) error {
+			return NewKeyring([]*Key{current}, nil).WithEncryption(keys, legacy).Load(now)
+		}
+		assert.NoError(t, load(nil, ""))
+		assert.Error(t, load(nil, "short-a-reno"), "legacy passphrases must be long")
+		assert.Error(t, load([]*EncryptionKey{{ID: "weak", Secret: "secret-a-reno"}}, ""), "secrets must be base64")
+		assert.Error(t, load([]*EncryptionKey{{ID: "short", Secret: base64.StdEncoding.EncodeToString([]byte("key"))}},
+			""), "secrets must be 32 bytes")
+		assert.Error(t, load([]*EncryptionKey{{Secret: next.Secret}}, ""))
+		assert.Error(t, load([]*EncryptionKey{next, {ID: "next", Secret: old.Secret}}, ""))
+		assert.Error(t, load([]*EncryptionKey{encryptionKey("later", now.Add(time.Hour))}, ""),
+			"no encryption key is active yet")
+		assert.NoError(t, load([]*EncryptionKey{encryptionKey("later", now.Add(time.Hour))}, legacy))
+		assert.Error(t, NewKeyring([]*Key{current}, nil).RequireEncryption(true).Load(now),
+			"encryption is required but not configured")
+	})
+}
+
+func TestKeyringAsymmetric(t *testing.T) {
+	now := time.Now()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	claims := jwt.Claims{Subject: "loon@yellowrustrise.co"}
+
+	for _, tc := range []struct {
+		name      string
+		key       crypto.Signer
+		algorithm jose.SignatureAlgorithm
+	}{
+		{"RSA", rsaKey, jose.RS256},
+		{"ECDSA", ecKey, jose.ES256},
+		{"Ed25519", edKey, jose.EdDSA},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			der, err := x509.MarshalPKCS8PrivateKey(tc.key)
+			require.NoError(t, err)
+			dir, err := ioutil.TempDir("", "keys")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "key.pem")
+			err = ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+			require.NoError(t, err)
+			keyring := NewKeyring([]*Key{{ID: tc.name, PrivateKeyFile: file, ActiveFrom: now}}, nil)
+			require.NoError(t, keyring.Load(now))
+
+			tokenStr, err := keyring.Sign(claims)
+			require.NoError(t, err)
+			token, err := jwt.ParseSigned(tokenStr)
+			require.NoError(t, err)
+			assert.Equal(t, string(tc.algorithm), token.Headers[0].Algorithm)
+			require.NoError(t, keyring.Claims(token, &jwt.Claims{}))
+
+			// Verify as a downstream service would with only the published key set
+			published, err := json.Marshal(keyring.PublicKeys())
+			require.NoError(t, err)
+			jwks := jose.JSONWebKeySet{}
+			require.NoError(t, json.Unmarshal(published, &jwks))
+			keys := jwks.Key(tc.name)
+			require.Len(t, keys, 1)
+			assert.True(t, keys[0].IsPublic())
+			out := jwt.Claims{}
+			require.NoError(t, token.Claims(keys[0].Key, &out))
+			assert.Equal(t, claims.Subject, out.Subject)
+		})
+	}
+
+	t.Run("PKCS #1 and SEC 1 keys", func(t *testing.T) {
+		ecDER, err := x509.MarshalECPrivateKey(ecKey)
+		require.NoError(t, err)
+		keyring := NewKeyring([]*Key{
+			{ID: "rsa", PrivateKey: string(pem.EncodeToMemory(&pem.Block{
+				Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))},
+			{ID: "ec", PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}))},
+		}, nil)
+		require.NoError(t, keyring.Load(now))
+		assert.Len(t, keyring.PublicKeys().Keys, 2)
+	})
+
+	t.Run("HMAC signed with the public key", func(t *testing.T) {
+		der, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+		require.NoError(t, err)
+		public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		tokenStr, err := NewKeyring([]*Key{{ID: "rsa", Secret: string(public)}}, nil).Sign(claims)
+		require.NoError(t, err)
+		token, err := jwt.ParseSigned(tokenStr)
+		require.NoError(t, err)
+
+		keyring := NewKeyring([]*Key{{ID: "rsa", PrivateKey: string(pem.EncodeToMemory(&pem.Block{
+			Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))}}, nil)
+		require.NoError(t, keyring.Load(now))
+		assert.Error(t, keyring.Claims(token, &jwt.Claims{}))
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		assert.Error(t, NewKeyring([]*Key{{ID: "bad", PrivateKey: "not a key"}}, nil).Load(now))
+		assert.Error(t, NewKeyring([]*Key{{ID: "both", Secret: "key-a-reno", PrivateKeyFile: "key.pem"}}, nil).Load(now))
+		assert.Error(t, NewKeyring([]*Key{{ID: "missing", PrivateKeyFile: "/does/not/exist.pem"}}, nil).Load(now))
+	})
+}
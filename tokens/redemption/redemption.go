@@ -0,0 +1,57 @@
+package redemption
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Records are kept for this long past the expiry of their token, as tokens are still accepted within the leeway
+// jwt.Claims.Validate allows for clock skew
+const expiryLeeway = jwt.DefaultLeeway
+
+// Store records the IDs of single-use tokens that have been used. Redeem must be atomic so that only one of any
+// concurrent redemptions of a token succeeds.
+type Store interface {
+	// Redeem marks the token with id as used, returning false if it already was. The record may be dropped once the
+	// token has expired and the leeway for clock skew has passed, when the token is rejected anyway.
+	Redeem(id string, expiry time.Time) (bool, error)
+	// Release undoes a redemption when consuming the token failed so that it can be used again
+	Release(id string) error
+}
+
+type memoryStore struct {
+	sync.Mutex
+	redeemed map[string]time.Time
+}
+
+// NewMemoryStore returns a Store that does not persist, useful for testing and development
+func NewMemoryStore() Store {
+	return &memoryStore{
+		redeemed: make(map[string]time.Time),
+	}
+}
+
+func (s *memoryStore) Redeem(id string, expiry time.Time) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	for k, e := range s.redeemed {
+		if e.Before(now) {
+			delete(s.redeemed, k)
+		}
+	}
+	if _, ok := s.redeemed[id]; ok {
+		return false, nil
+	}
+	s.redeemed[id] = expiry.Add(expiryLeeway)
+	return true, nil
+}
+
+func (s *memoryStore) Release(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.redeemed, id)
+	return nil
+}
@@ -0,0 +1,58 @@
+package redemption
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	expiry := time.Now().Add(time.Hour)
+
+	ok, err := store.Redeem("a", expiry)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.Redeem("a", expiry)
+	require.NoError(t, err)
+	assert.False(t, ok, "tokens can only be redeemed once")
+
+	require.NoError(t, store.Release("a"))
+	ok, err = store.Redeem("a", expiry)
+	require.NoError(t, err)
+	assert.True(t, ok, "released tokens can be redeemed again")
+
+	t.Run("tokens just past expiry", func(t *testing.T) {
+		// The token is still accepted within the leeway so its record must outlast the expiry
+		ok, err := store.Redeem("expired", time.Now().Add(-time.Second))
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = store.Redeem("expired", time.Now().Add(-time.Second))
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("concurrent redemptions", func(t *testing.T) {
+		var wg sync.WaitGroup
+		var mtx sync.Mutex
+		redeemed := 0
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := store.Redeem("b", expiry)
+				assert.NoError(t, err)
+				if ok {
+					mtx.Lock()
+					redeemed++
+					mtx.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 1, redeemed)
+	})
+}
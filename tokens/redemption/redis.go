@@ -0,0 +1,31 @@
+package redemption
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const redeemedKeyPrefix = "pericyte:tokens:redeemed:"
+
+type redisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore returns a Store keeping a key per redeemed token that expires with the token
+func NewRedisStore(client *redis.Client) Store {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) Redeem(id string, expiry time.Time) (bool, error) {
+	ttl := time.Until(expiry.Add(expiryLeeway))
+	if ttl < time.Second {
+		// Redis rejects shorter expiries, and the token is rejected by now anyway
+		ttl = time.Second
+	}
+	return s.client.SetNX(redeemedKeyPrefix+id, time.Now().Unix(), ttl).Result()
+}
+
+func (s *redisStore) Release(id string) error {
+	return s.client.Del(redeemedKeyPrefix + id).Err()
+}
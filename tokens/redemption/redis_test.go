@@ -0,0 +1,55 @@
+// +build integration
+
+package redemption
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redisTestURL = "redis://localhost:6379/0"
+
+func TestRedisStore(t *testing.T) {
+	client := redisClient(t)
+	store := NewRedisStore(client)
+	expiry := time.Now().Add(time.Hour)
+
+	ok, err := store.Redeem("a", expiry)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.Redeem("a", expiry)
+	require.NoError(t, err)
+	assert.False(t, ok, "tokens can only be redeemed once")
+	ttl, err := client.TTL(redeemedKeyPrefix + "a").Result()
+	require.NoError(t, err)
+	assert.InDelta(t, (time.Hour + expiryLeeway).Seconds(), ttl.Seconds(), 5,
+		"the record expires with the token and its leeway")
+
+	require.NoError(t, store.Release("a"))
+	ok, err = store.Redeem("a", expiry)
+	require.NoError(t, err)
+	assert.True(t, ok, "released tokens can be redeemed again")
+
+	// The token is still accepted within the leeway so its record must outlast the expiry
+	ok, err = store.Redeem("expired", time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.Redeem("expired", time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ttl, err = client.TTL(redeemedKeyPrefix + "expired").Result()
+	require.NoError(t, err)
+	assert.InDelta(t, (expiryLeeway - time.Second).Seconds(), ttl.Seconds(), 5)
+}
+
+func redisClient(t *testing.T) *redis.Client {
+	opts, err := redis.ParseURL(redisTestURL)
+	require.NoError(t, err)
+	cli := redis.NewClient(opts)
+	require.NoError(t, cli.FlushAll().Err())
+	return cli
+}
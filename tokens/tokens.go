@@ -0,0 +1,14 @@
+// Package tokens holds what is shared by the tokens we send by email, each purpose of which has a package of its own
+package tokens
+
+import (
+	"code.monax.io/monax/pericyte/config"
+	"code.monax.io/monax/pericyte/tokens/keys"
+)
+
+// Keyring returns the keys that sign, verify and optionally encrypt the tokens we send by email
+func Keyring(cfg *config.Config) *keys.Keyring {
+	return keys.NewKeyring(cfg.PasswordlessTokenKeys, cfg.PasswordlessTokenSigningKey).
+		WithEncryption(cfg.PasswordlessTokenEncryptionKeys, cfg.PasswordlessTokenEncryptionKey).
+		RequireEncryption(cfg.PasswordlessTokenEncryptionRequired)
+}
@@ -2,9 +2,12 @@ package workers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/vmihailenco/taskq/v2"
 )
 
@@ -47,7 +50,13 @@ func DefaultParams() *Params {
 func NewDispatcher(queue taskq.Queue, params *Params, name string, handler interface{},
 	errorReporter func(error)) Dispatcher {
 
-	task := registerTask(params, name, handler, fallbackHandler(errorReporter))
+	var task *taskq.Task
+	requeue := func(delay time.Duration, args []interface{}) error {
+		msg := task.WithArgs(context.Background(), args...)
+		msg.Delay = delay
+		return queue.Add(msg)
+	}
+	task = registerTask(params, name, withErrorHandling(handler, requeue), fallbackHandler(errorReporter))
 
 	return func(args ...interface{}) error {
 		msg := task.OnceWithArgs(context.Background(), params.DeduplicationWindow, args...)
@@ -57,6 +66,18 @@ func NewDispatcher(queue taskq.Queue, params *Params, name string, handler inter
 	}
 }
 
+// JobID identifies the job of task name with args dispatched now. Jobs with the same args dispatched in the same
+// deduplication window get the same ID so that the ID can itself be an arg without defeating deduplication. Without a
+// deduplication window every job is distinct and gets a fresh ID.
+func JobID(params *Params, name string, args ...interface{}) string {
+	if params.DeduplicationWindow <= 0 {
+		return uuid.New().String()
+	}
+	slot := time.Now().UnixNano() / int64(params.DeduplicationWindow)
+	job := fmt.Sprintf("%s:%d:%#v", taskName(params.Namespace, name), slot, args)
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(job)).String()
+}
+
 func fallbackHandler(errorReporter func(error)) func(context.Context, *taskq.Message) {
 	return func(ctx context.Context, msg *taskq.Message) {
 		name := ""
@@ -86,3 +107,112 @@ func taskName(namespace, name string) string {
 	}
 	return namespace + ":" + name
 }
+
+// Permanent marks err as a failure that retrying will not resolve so the message is dropped rather than retried.
+// Permanent failures are not reported so handlers should log them where they are of interest.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent returns true if err or any error it wraps has a Permanent() method returning true
+func IsPermanent(err error) bool {
+	var p interface{ Permanent() bool }
+	return errors.As(err, &p) && p.Permanent()
+}
+
+type permanentError struct {
+	error
+}
+
+func (err permanentError) Unwrap() error {
+	return err.error
+}
+
+func (err permanentError) Permanent() bool {
+	return true
+}
+
+// Delayer is implemented by errors that know how long to wait before the message is retried, such as a rate limit
+// reached. Waiting is not a failure so the job is put back on the queue as a new message after the delay rather than
+// retried, and does not count towards the retry limit. It matches the interface taskq checks handler errors for.
+type Delayer interface {
+	Delay() time.Duration
+}
+
+// delayError exposes the delay of an error it wraps directly since taskq does not unwrap errors. It is returned to
+// taskq, counting as a retry, only if the job could not be requeued.
+type delayError struct {
+	error
+	delay time.Duration
+}
+
+func (err delayError) Unwrap() error {
+	return err.error
+}
+
+func (err delayError) Delay() time.Duration {
+	return err.delay
+}
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	messageType = reflect.TypeOf((*taskq.Message)(nil))
+)
+
+// withErrorHandling wraps handler so that a permanent error is swallowed and the message acknowledged, and so that
+// the job is requeued after the delay of a wrapped Delayer error. taskq inspects the handler signature so the
+// wrapper has exactly the same type as handler.
+func withErrorHandling(handler interface{}, requeue func(delay time.Duration, args []interface{}) error) interface{} {
+	fn := reflect.ValueOf(handler)
+	typ := fn.Type()
+	if typ.Kind() != reflect.Func || typ.NumOut() == 0 || typ.Out(typ.NumOut()-1) != errorType {
+		return handler
+	}
+	return reflect.MakeFunc(typ, func(in []reflect.Value) []reflect.Value {
+		var out []reflect.Value
+		if typ.IsVariadic() {
+			out = fn.CallSlice(in)
+		} else {
+			out = fn.Call(in)
+		}
+		last := len(out) - 1
+		if err, ok := out[last].Interface().(error); ok {
+			var delayer Delayer
+			switch {
+			case IsPermanent(err):
+				out[last] = reflect.Zero(errorType)
+			case errors.As(err, &delayer):
+				if requeue(delayer.Delay(), jobArgs(typ, in)) == nil {
+					out[last] = reflect.Zero(errorType)
+					break
+				}
+				delayed := reflect.New(errorType).Elem()
+				delayed.Set(reflect.ValueOf(delayError{err, delayer.Delay()}))
+				out[last] = delayed
+			}
+		}
+		return out
+	}).Interface()
+}
+
+// jobArgs recovers the args the job was dispatched with from the arguments taskq called its handler of type typ with
+func jobArgs(typ reflect.Type, in []reflect.Value) []interface{} {
+	if len(in) > 0 && typ.In(0) == messageType {
+		return in[0].Interface().(*taskq.Message).Args
+	}
+	var args []interface{}
+	for i, v := range in {
+		switch {
+		case i == 0 && typ.In(0) == contextType:
+			continue
+		case i == len(in)-1 && typ.IsVariadic():
+			for j := 0; j < v.Len(); j++ {
+				args = append(args, v.Index(j).Interface())
+			}
+		default:
+			args = append(args, v.Interface())
+		}
+	}
+	return args
+}
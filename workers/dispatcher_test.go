@@ -4,6 +4,7 @@ package workers
 
 import (
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -69,6 +70,71 @@ func TestWorkers(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, email, <-ch)
 	})
+
+	t.Run("Permanent failure is not retried", func(t *testing.T) {
+		params := DefaultParams()
+		params.MinBackoff = time.Millisecond
+		params.Namespace = "permanent"
+		ch := make(chan interface{}, 2)
+		dispatcher := NewDispatcher(queue, params, "TestDispatcher",
+			func(msg *taskq.Message) error {
+				ch <- msg.ReservedCount
+				return fmt.Errorf("wrapped: %w", Permanent(fmt.Errorf("cannot succeed")))
+			},
+			func(err error) {
+				ch <- err
+			})
+
+		err := dispatcher("foo@bar3.net")
+		require.NoError(t, err)
+		assert.Equal(t, 1, <-ch)
+		select {
+		case v := <-ch:
+			t.Fatalf("expected no retry or fallback but got %v", v)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("Delay from error replaces backoff", func(t *testing.T) {
+		params := DefaultParams()
+		params.MinBackoff = time.Hour
+		params.RetryLimit = 1
+		params.Namespace = "delay"
+		ch := make(chan interface{}, 2)
+		var attempts int32
+		dispatcher := NewDispatcher(queue, params, "TestDispatcher",
+			func(email string) error {
+				// Waiting does not use up the retry limit
+				if atomic.AddInt32(&attempts, 1) <= 2 {
+					return fmt.Errorf("wrapped: %w", testDelayer(time.Millisecond))
+				}
+				ch <- email
+				return nil
+			},
+			func(err error) {
+				ch <- err
+			})
+
+		email := "foo@bar4.net"
+		err := dispatcher(email)
+		require.NoError(t, err)
+		select {
+		case v := <-ch:
+			assert.Equal(t, email, v)
+		case <-time.After(time.Second):
+			t.Fatal("expected retry after delay rather than backoff")
+		}
+	})
+}
+
+type testDelayer time.Duration
+
+func (d testDelayer) Error() string {
+	return "try again later"
+}
+
+func (d testDelayer) Delay() time.Duration {
+	return time.Duration(d)
 }
 
 func flushRedis(t *testing.T) {
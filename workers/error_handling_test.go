@@ -0,0 +1,56 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithErrorHandling(t *testing.T) {
+	var requeued []interface{}
+	var requeuedDelay time.Duration
+	requeueErr := error(nil)
+	requeue := func(delay time.Duration, args []interface{}) error {
+		requeued, requeuedDelay = args, delay
+		return requeueErr
+	}
+	var handlerErr error
+	handler := withErrorHandling(func(ctx context.Context, accountID int, email string) error {
+		return handlerErr
+	}, requeue).(func(context.Context, int, string) error)
+
+	handlerErr = errors.New("failed")
+	assert.Equal(t, handlerErr, handler(context.Background(), 4, "cora@monax.io"))
+	assert.Nil(t, requeued)
+
+	handlerErr = fmt.Errorf("wrapped: %w", Permanent(errors.New("cannot succeed")))
+	assert.NoError(t, handler(context.Background(), 4, "cora@monax.io"))
+
+	handlerErr = fmt.Errorf("wrapped: %w", delayError{errors.New("rate limited"), time.Minute})
+	assert.NoError(t, handler(context.Background(), 4, "cora@monax.io"), "requeued rather than retried")
+	assert.Equal(t, []interface{}{4, "cora@monax.io"}, requeued)
+	assert.Equal(t, time.Minute, requeuedDelay)
+
+	requeueErr = errors.New("queue unavailable")
+	err := handler(context.Background(), 4, "cora@monax.io")
+	var delayer Delayer
+	require.True(t, errors.As(err, &delayer), "retried with the delay when it cannot be requeued")
+	assert.Equal(t, time.Minute, delayer.Delay())
+}
+
+func TestJobArgsVariadic(t *testing.T) {
+	var requeued []interface{}
+	handler := withErrorHandling(func(args ...interface{}) error {
+		return delayError{errors.New("rate limited"), time.Second}
+	}, func(delay time.Duration, args []interface{}) error {
+		requeued = args
+		return nil
+	}).(func(...interface{}) error)
+	require.NoError(t, handler("a", 1))
+	assert.Equal(t, []interface{}{"a", 1}, requeued)
+}
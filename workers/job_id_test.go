@@ -0,0 +1,27 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobID(t *testing.T) {
+	params := DefaultParams()
+	params.DeduplicationWindow = time.Hour
+	id := JobID(params, "Test", 1, "foo@bar.net")
+	assert.NotEmpty(t, id)
+	assert.Equal(t, id, JobID(params, "Test", 1, "foo@bar.net"), "same job in the same window")
+	assert.NotEqual(t, id, JobID(params, "Test", 2, "foo@bar.net"), "different args")
+	assert.NotEqual(t, id, JobID(params, "Other", 1, "foo@bar.net"), "different task")
+
+	namespaced := *params
+	namespaced.Namespace = "tenant"
+	assert.NotEqual(t, id, JobID(&namespaced, "Test", 1, "foo@bar.net"), "different namespace")
+
+	params.DeduplicationWindow = 0
+	id = JobID(params, "Test", 1, "foo@bar.net")
+	assert.NotEmpty(t, id)
+	assert.NotEqual(t, id, JobID(params, "Test", 1, "foo@bar.net"), "no deduplication so every job is distinct")
+}